@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// buttons are the hall call buttons on one floor.
+type buttons int
+
+const (
+	buttonUp buttons = 1 << iota
+	buttonDown
+	buttonNone buttons = 0
+)
+
+var buttonNames = map[buttons]string{buttonUp: "U", buttonDown: "D", buttonUp | buttonDown: "UD", buttonNone: "-"}
+
+// hallButtons lists the call buttons on each floor, bottom floor first. Knuth
+// puts both buttons on every floor; nil stands for that. A floor with no buttons
+// at all is one where nobody may call the elevator, such as a restricted floor,
+// though the elevator still takes people there.
+type hallButtons []buttons
+
+// String writes the buttons as the -buttons option reads them, such as
+// "U,UD,-,UD,D".
+func (h hallButtons) String() string {
+	names := make([]string, len(h))
+	for j, b := range h {
+		names[j] = buttonNames[b]
+	}
+	return strings.Join(names, ",")
+}
+
+func (h *hallButtons) Set(value string) error {
+	var floors hallButtons
+	for j, field := range strings.Split(value, ",") {
+		field = strings.ToUpper(strings.TrimSpace(field))
+		b, ok := buttonNone, false
+		for k, name := range buttonNames {
+			if field == name {
+				b, ok = k, true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("floor %d: buttons %q are not U, D, UD, or -", j, field)
+		}
+		floors = append(floors, b)
+	}
+	*h = floors
+	return nil
+}
+
+// has tells whether floor j has the call button for the direction.
+func (h hallButtons) has(j, direction int) bool {
+	if h == nil {
+		return true
+	}
+	if direction == stateGoingUp {
+		return h[j]&buttonUp != 0
+	}
+	return h[j]&buttonDown != 0
+}
+
+// check tells why a user cannot call the elevator on floor in to go to floor
+// out, or returns nil if the user can.
+func (h hallButtons) check(in, out int) error {
+	if out > in && !h.has(in, stateGoingUp) {
+		return fmt.Errorf("floor %d has no up button", in)
+	}
+	if out < in && !h.has(in, stateGoingDown) {
+		return fmt.Errorf("floor %d has no down button", in)
+	}
+	return nil
+}
+
+// validate rejects buttons that do not fit a building of the given number of
+// floors, and buildings where nobody can call the elevator at all.
+func (h hallButtons) validate(floors int) error {
+	if h == nil {
+		return nil
+	}
+	if len(h) != floors {
+		return fmt.Errorf("buttons are given for %d floors, but there are %d", len(h), floors)
+	}
+	if h[0]&buttonDown != 0 {
+		return fmt.Errorf("floor 0 cannot have a down button")
+	}
+	if h[floors-1]&buttonUp != 0 {
+		return fmt.Errorf("floor %d cannot have an up button", floors-1)
+	}
+	for _, b := range h {
+		if b != buttonNone {
+			return nil
+		}
+	}
+	return fmt.Errorf("no floor has a call button")
+}
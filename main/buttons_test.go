@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHallButtons(t *testing.T) {
+	tests := []struct {
+		value   string
+		floors  int
+		wantErr string
+	}{
+		{"U,UD,-,ud,D", 5, ""},
+		{"U,D", 2, ""},
+		{"U,UD,D", 5, "buttons are given for 3 floors, but there are 5"},
+		{"UD,D", 2, "floor 0 cannot have a down button"},
+		{"U,U", 2, "floor 1 cannot have an up button"},
+		{"-,-,-", 3, "no floor has a call button"},
+		{"U,X,D", 3, `floor 1: buttons "X" are not U, D, UD, or -`},
+	}
+	for _, tt := range tests {
+		cfg := newConfig()
+		cfg.floors, cfg.home = tt.floors, 0
+		err := cfg.flagSet().Parse([]string{"-buttons=" + tt.value})
+		if err == nil {
+			err = cfg.validate()
+		}
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.value, err)
+			} else if got := cfg.buttons.String(); got != strings.ToUpper(tt.value) {
+				t.Errorf("%s: written as %s", tt.value, got)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want %q", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+// Random users only enter where they can call the elevator for their trip; the
+// trips that need a missing button are drawn again and counted.
+func TestButtonsRandomArrivals(t *testing.T) {
+	for _, buttons := range []string{"", "U,UD,-,D,D"} {
+		cfg := newConfig()
+		if buttons != "" {
+			if err := cfg.buttons.Set(buttons); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cfg.seed = 1
+		cfg.duration = 50000
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		s := newSimulator(cfg)
+		if err := s.run(); err != nil {
+			t.Fatalf("%q: %v", buttons, err)
+		}
+		if len(s.users) < 50 {
+			t.Fatalf("%q: only %d users", buttons, len(s.users))
+		}
+		reached := false
+		for _, u := range s.users {
+			if err := cfg.buttons.check(u.in, u.out); err != nil {
+				t.Errorf("%q: user %d from %d to %d: %v", buttons, u.id, u.in, u.out, err)
+			}
+			reached = reached || u.out == 2
+		}
+		if !reached {
+			t.Errorf("%q: nobody went to floor 2", buttons)
+		}
+		if redrawn := s.stats.redrawnArrivals; (redrawn > 0) != (buttons != "") {
+			t.Errorf("%q: %d arrivals redrawn", buttons, redrawn)
+		}
+	}
+	cfg := newConfig()
+	if err := cfg.buttons.Set("U,UD,-,D,D"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := replicate(cfg, 1, 3, 2); err != nil {
+		t.Errorf("replicate returned %v", err)
+	}
+}
+
+func TestButtonsScriptedArrival(t *testing.T) {
+	cfg := newConfig()
+	if err := cfg.buttons.Set("U,UD,UD,UD,-"); err != nil {
+		t.Fatal(err)
+	}
+	s := newSimulator(cfg)
+	s.script = []arrival{{time: 0, in: 1, out: 4, giveUpTime: 500}, {time: 30, in: 4, out: 0, giveUpTime: 500}}
+	err := s.run()
+	if want := "time 30: user 2 arrives at floor 4 going to 0, but floor 4 has no down button"; err == nil || err.Error() != want {
+		t.Errorf("run returned %v, want %q", err, want)
+	}
+}
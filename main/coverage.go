@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// The branches are the special cases of the algorithm, each counted every time
+// a run takes it, to show which parts of the algorithm matter under a given
+// traffic.
+const (
+	branchDoorsClosing = iota // U2: a user stops the doors closing
+	branchDoorsOpen           // U2: a user arrives at open doors and restarts E4
+	branchAlmostGaveUp        // U4: a user stays because people are getting in or out
+	branchFlutter             // E5: the doors flutter
+	branchInaction            // E9: the inaction indicator is set
+	branchDormantHome         // D2: the dormant elevator opens its doors for a call on the home floor
+	branchNoCallsHome         // D3: no calls, invoked from E6, so j is the home floor
+	branchWakeUp              // D5: the dormant elevator is set to perform E6
+	branches
+)
+
+var branchNames = [branches]string{
+	"U2 doors closing",
+	"U2 doors open",
+	"U4 almost gave up",
+	"E5 flutter",
+	"E9 inaction",
+	"D2 call on home floor",
+	"D3 no calls, home",
+	"D5 wake up",
+}
+
+// coverage counts how many times a run took each branch.
+type coverage [branches]int
+
+func (c *coverage) report(w io.Writer) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "branch\tcount")
+	for b, n := range c {
+		fmt.Fprintf(w, "%s\t%d\n", branchNames[b], n)
+	}
+}
+
+// reportCoverage adds up the coverage of several replications: how many times
+// each branch was taken in all, per run, and in how many of the runs.
+func reportCoverage(w io.Writer, runs []coverage) {
+	fmt.Fprintln(w, "branch\ttotal\tmean\truns")
+	for b := range branchNames {
+		total, taken := 0, 0
+		for _, c := range runs {
+			total += c[b]
+			if c[b] > 0 {
+				taken++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.4g\t%d/%d\n", branchNames[b], total, ratio(total, len(runs)), taken, len(runs))
+	}
+}
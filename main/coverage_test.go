@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// The example in the README stops the doors closing once (user 2 at 79), opens
+// the doors of the dormant elevator for user 1, sends the car home twice, and
+// sets the inaction indicator at the end.
+func TestCoverage(t *testing.T) {
+	sc, err := loadScenario("testdata/readme.scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	if err := sc.configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	s, _, err := sc.run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want coverage
+	want[branchDoorsClosing] = 1
+	want[branchDormantHome] = 1
+	want[branchNoCallsHome] = 2
+	want[branchInaction] = 1
+	if s.cover != want {
+		t.Errorf("coverage %v, want %v", s.cover, want)
+	}
+}
+
+func TestReportCoverage(t *testing.T) {
+	var a, b coverage
+	a[branchFlutter], b[branchFlutter] = 3, 0
+	a[branchWakeUp], b[branchWakeUp] = 1, 2
+	var out bytes.Buffer
+	reportCoverage(&out, []coverage{a, b})
+	for _, line := range []string{"E5 flutter\t3\t1.5\t1/2", "D5 wake up\t3\t1.5\t2/2", "U4 almost gave up\t0\t0\t0/2"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("no line %q in\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// A diagram records a run as the classic space–time picture of an elevator:
+// simulated time runs from left to right, floors from bottom to top, and the
+// car traces a line between them.
+type diagram struct {
+	path   []diagramPoint  // the car's floor over time
+	doors  []diagramPeriod // times the doors were not closed, by floor
+	marks  []diagramMark   // user milestones
+	open   *diagramPeriod  // the door period in progress
+	end    int
+	floors int
+}
+
+type diagramPoint struct {
+	time  int
+	floor int
+}
+
+type diagramPeriod struct {
+	floor int
+	from  int
+	to    int
+}
+
+type diagramMark struct {
+	diagramPoint
+	id        int
+	milestone int
+	step      string
+}
+
+func newDiagram() *diagram {
+	return &diagram{}
+}
+
+func (d *diagram) observe(s *simulator, e *event) {
+	d.end = e.time
+	d.floors = s.cfg.floors
+	if e.explanation {
+		return
+	}
+	if e.user != nil {
+		if e.milestone != userWaits {
+			floor := e.floor
+			if e.milestone == userArrives || e.milestone == userWalks {
+				floor = e.user.in
+			}
+			d.marks = append(d.marks, diagramMark{diagramPoint{e.time, floor}, e.user.id, e.milestone, e.step})
+		}
+		return
+	}
+	switch e.step {
+	case "E3":
+		if d.open == nil {
+			d.open = &diagramPeriod{floor: e.floor, from: e.time}
+		}
+	case "E6":
+		if d.open != nil {
+			d.open.to = e.time
+			d.doors = append(d.doors, *d.open)
+			d.open = nil
+		}
+	}
+	d.path = append(d.path, diagramPoint{e.time, e.floor})
+}
+
+// A painter is a surface the diagram can be drawn on.
+type painter interface {
+	line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	rect(x, y, w, h float64, c color.RGBA)
+	circle(x, y, r float64, c color.RGBA)
+	text(x, y float64, s string)
+}
+
+var (
+	colorGrid     = color.RGBA{0xcc, 0xcc, 0xcc, 0xff}
+	colorCar      = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	colorDoors    = color.RGBA{0xbb, 0xdd, 0xff, 0xff}
+	colorArrive   = color.RGBA{0x33, 0x66, 0xcc, 0xff}
+	colorBoard    = color.RGBA{0x22, 0x99, 0x22, 0xff}
+	colorAlight   = color.RGBA{0xee, 0x88, 0x00, 0xff}
+	colorGiveUp   = color.RGBA{0xdd, 0x00, 0x00, 0xff}
+	colorWalk     = color.RGBA{0x99, 0x00, 0x99, 0xff}
+	colorBackdrop = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+const (
+	diagramWidth       = 1200
+	diagramFloorHeight = 80
+	diagramMargin      = 50
+)
+
+func (d *diagram) size() (int, int) {
+	return diagramWidth, diagramFloorHeight*(d.floors-1) + 2*diagramMargin
+}
+
+func (d *diagram) paint(p painter) {
+	width, height := d.size()
+	end := d.end
+	if d.open != nil {
+		d.doors = append(d.doors, diagramPeriod{d.open.floor, d.open.from, end})
+		d.open = nil
+	}
+	if end == 0 {
+		end = 1
+	}
+	x := func(t int) float64 {
+		return diagramMargin + float64(t)*float64(width-2*diagramMargin)/float64(end)
+	}
+	y := func(floor int) float64 {
+		return float64(height-diagramMargin) - float64(floor*diagramFloorHeight)
+	}
+
+	p.rect(0, 0, float64(width), float64(height), colorBackdrop)
+	for j := 0; j < d.floors; j++ {
+		p.line(x(0), y(j), x(end), y(j), colorGrid, 1)
+		p.text(8, y(j)+4, fmt.Sprintf("%d", j))
+	}
+	step := 1000
+	for end/step > 12 {
+		step *= 2
+	}
+	for t := 0; t <= end; t += step {
+		p.line(x(t), y(0), x(t), y(0)+5, colorGrid, 1)
+		p.text(x(t)-10, y(0)+20, fmt.Sprintf("%ds", t/10))
+	}
+	legend := []struct {
+		label string
+		c     color.RGBA
+	}{
+		{"car", colorCar}, {"doors open", colorDoors}, {"arrival", colorArrive}, {"gets in", colorBoard},
+		{"gets out", colorAlight}, {"gives up", colorGiveUp}, {"walks at once", colorWalk},
+	}
+	for i, l := range legend {
+		lx := float64(diagramMargin + i*110)
+		p.rect(lx, 12, 10, 10, l.c)
+		p.text(lx+14, 21, l.label)
+	}
+	for _, o := range d.doors {
+		p.rect(x(o.from), y(o.floor)-8, x(o.to)-x(o.from), 16, colorDoors)
+	}
+	for i := 1; i < len(d.path); i++ {
+		a, b := d.path[i-1], d.path[i]
+		p.line(x(a.time), y(a.floor), x(b.time), y(b.floor), colorCar, 2)
+	}
+	for _, m := range d.marks {
+		mx, my := x(m.time), y(m.floor)
+		switch m.milestone {
+		case userArrives:
+			p.circle(mx, my-14, 3, colorArrive)
+			p.text(mx+4, my-18, fmt.Sprintf("%d", m.id))
+		case userBoards:
+			p.line(mx, my-4, mx, my-16, colorBoard, 2)
+		case userAlights:
+			p.line(mx, my+4, mx, my+16, colorAlight, 2)
+		case userWalks:
+			c := colorWalk
+			if m.step == "U4" {
+				c = colorGiveUp
+			}
+			p.line(mx-5, my-19, mx+5, my-9, c, 2)
+			p.line(mx-5, my-9, mx+5, my-19, c, 2)
+			p.text(mx+6, my-18, fmt.Sprintf("%d", m.id))
+		}
+	}
+}
+
+// svgPainter writes the diagram as a scalable vector graphic.
+type svgPainter struct {
+	b strings.Builder
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (p *svgPainter) line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	fmt.Fprintf(&p.b, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"%s\" stroke-width=\"%g\"/>\n",
+		x1, y1, x2, y2, svgColor(c), width)
+}
+
+func (p *svgPainter) rect(x, y, w, h float64, c color.RGBA) {
+	fmt.Fprintf(&p.b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"/>\n", x, y, w, h, svgColor(c))
+}
+
+func (p *svgPainter) circle(x, y, r float64, c color.RGBA) {
+	fmt.Fprintf(&p.b, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"%g\" fill=\"%s\"/>\n", x, y, r, svgColor(c))
+}
+
+func (p *svgPainter) text(x, y float64, s string) {
+	fmt.Fprintf(&p.b, "<text x=\"%.1f\" y=\"%.1f\" font-family=\"sans-serif\" font-size=\"10\">%s</text>\n", x, y, s)
+}
+
+func (d *diagram) writeSVG(w io.Writer) error {
+	width, height := d.size()
+	p := &svgPainter{}
+	d.paint(p)
+	_, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n%s</svg>\n",
+		width, height, p.b.String())
+	return err
+}
+
+// pngPainter rasterizes the diagram. It has no font, so labels are left out.
+type pngPainter struct {
+	img *image.RGBA
+}
+
+func (p *pngPainter) line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	n := int(max(abs(x2-x1), abs(y2-y1))) + 1
+	for i := 0; i <= n; i++ {
+		t := float64(i) / float64(n)
+		p.circle(x1+t*(x2-x1), y1+t*(y2-y1), width/2, c)
+	}
+}
+
+func (p *pngPainter) rect(x, y, w, h float64, c color.RGBA) {
+	r := image.Rect(int(x), int(y), int(x+w+0.5), int(y+h+0.5))
+	draw.Draw(p.img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+func (p *pngPainter) circle(x, y, r float64, c color.RGBA) {
+	for py := int(y - r); py <= int(y+r); py++ {
+		for px := int(x - r); px <= int(x+r); px++ {
+			dx, dy := float64(px)-x, float64(py)-y
+			if dx*dx+dy*dy <= r*r+0.5 {
+				p.img.SetRGBA(px, py, c)
+			}
+		}
+	}
+}
+
+func (p *pngPainter) text(x, y float64, s string) {}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (d *diagram) writePNG(w io.Writer) error {
+	width, height := d.size()
+	p := &pngPainter{img: image.NewRGBA(image.Rect(0, 0, width, height))}
+	d.paint(p)
+	return png.Encode(w, p.img)
+}
+
+// writeFile creates the named file and fills it using write.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import "fmt"
+
+// doors is the state of the elevator doors. Knuth keeps it implicitly, in D1,
+// D3, and the step the elevator is at; here the doors move between explicit
+// states, and D1 and D3 are read off the state for the trace. (D2 is not about
+// the doors: it tells whether the elevator has been inactive.)
+type doors int
+
+const (
+	doorsClosed       doors = iota
+	doorsOpening            // E3, from closed
+	doorsOpenBoarding       // E4, people getting out or in (D1 ≠ 0)
+	doorsOpenIdle           // E4, nobody getting out or in (D3 ≠ 0)
+	doorsClosing            // E5
+	doorsReopening          // E3, before the doors have closed
+	doorStates
+)
+
+var doorNames = [doorStates]string{"closed", "opening", "open-boarding", "open-idle", "closing", "reopening"}
+
+func (d doors) String() string {
+	return doorNames[d]
+}
+
+// doorTransitions lists the states the doors may go to from each state. The
+// doors reopen in E3 when U2 sends the elevator there while they are closing,
+// or while they flutter in E5 with people still getting out or in.
+var doorTransitions = [doorStates][]doors{
+	doorsClosed:       {doorsOpening},
+	doorsOpening:      {doorsOpenBoarding, doorsOpenIdle, doorsReopening},
+	doorsOpenBoarding: {doorsOpenIdle, doorsReopening},
+	doorsOpenIdle:     {doorsOpenBoarding, doorsClosing},
+	doorsClosing:      {doorsClosed, doorsReopening},
+	doorsReopening:    {doorsOpenBoarding, doorsOpenIdle},
+}
+
+// D1 is nonzero from the time the doors start to open until everyone has
+// gotten out or in.
+func (d doors) d1() bool {
+	return d == doorsOpening || d == doorsReopening || d == doorsOpenBoarding
+}
+
+// D3 is nonzero while the doors are open but nobody is getting out or in.
+func (d doors) d3() bool {
+	return d == doorsOpenIdle
+}
+
+// setDoors moves the doors to a new state, adding the time spent in the old one
+// to the statistics. Staying in the same state is not a transition. A transition
+// the doors cannot make is a bug in the simulator.
+func (s *simulator) setDoors(to doors) {
+	from := s.ele.doors
+	if to == from {
+		return
+	}
+	legal := false
+	for _, d := range doorTransitions[from] {
+		legal = legal || d == to
+	}
+	if !legal {
+		panic(fmt.Sprintf("time %d: the doors cannot go from %s to %s", s.time, from, to))
+	}
+	s.stats.doorTime[from] += s.time - s.ele.doorsSince
+	s.stats.doorVisits[to]++
+	s.ele.doors, s.ele.doorsSince = to, s.time
+}
+
+// settleDoors adds the time the doors have spent in their present state at the
+// end of a run.
+func (s *simulator) settleDoors(end int) {
+	s.stats.doorTime[s.ele.doors] += end - s.ele.doorsSince
+	s.ele.doorsSince = end
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDoorTransitions(t *testing.T) {
+	s := newTestSimulator()
+	for _, to := range []doors{doorsOpening, doorsOpenBoarding, doorsOpenIdle, doorsClosing, doorsReopening, doorsOpenIdle, doorsClosing, doorsClosed} {
+		s.time += 10
+		s.setDoors(to)
+	}
+	want := [doorStates]int{1010, 10, 10, 20, 20, 10}
+	if s.stats.doorTime != want {
+		t.Errorf("time in each state %v, want %v", s.stats.doorTime, want)
+	}
+	if visits := [doorStates]int{2, 1, 1, 2, 2, 1}; s.stats.doorVisits != visits {
+		t.Errorf("visits to each state %v, want %v", s.stats.doorVisits, visits)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "cannot go from closed to open-idle") {
+			t.Errorf("recovered %v, want an illegal transition", r)
+		}
+	}()
+	s.setDoors(doorsOpenIdle)
+}
+
+// The doors account for the whole of a run, whether it ends at the duration or
+// when a scenario's users are gone.
+func TestDoorTime(t *testing.T) {
+	for _, name := range []string{"readme.scenario", "doors-closing.scenario"} {
+		sc, err := loadScenario("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := newConfig()
+		if err := sc.configure(cfg); err != nil {
+			t.Fatal(err)
+		}
+		s, _, err := sc.run(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, d := range s.stats.doorTime {
+			total += d
+		}
+		if total != min(s.time, cfg.duration) {
+			t.Errorf("%s: the doors account for %d, want %d", name, total, min(s.time, cfg.duration))
+		}
+		if name == "doors-closing.scenario" && s.stats.doorVisits[doorsReopening] == 0 {
+			t.Errorf("%s: the doors never reopened", name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// An event is one line of the trace: a step taken by a user or by the elevator,
+// along with the elevator's variables at that moment.
+type event struct {
+	time   int
+	state  int
+	floor  int
+	d1     bool
+	d2     bool
+	d3     bool
+	step   string // U1--U6 or E1--E9
+	action string
+
+	user        *user // the user taking the step (nil for elevator steps)
+	milestone   int   // what the step means for the user's journey
+	explanation bool  // the event tells why a rule fired rather than taking a step
+}
+
+// Milestones in a user's journey.
+const (
+	userWaits   = iota // pressing a button, queueing, or waiting on
+	userArrives        // entering the system in U1
+	userBoards         // getting in in U5
+	userAlights        // getting out in U6
+	userWalks          // leaving for the stairs, at once in U2 or on giving up in U4
+)
+
+// An observer is notified of each event as it happens. It may inspect the
+// simulator, but must not change it.
+type observer interface {
+	observe(s *simulator, e *event)
+}
+
+func stateRune(state int) rune {
+	switch state {
+	case stateGoingDown:
+		return 'D'
+	case stateGoingUp:
+		return 'U'
+	default:
+		return 'N'
+	}
+}
+
+func stateName(state int) string {
+	switch state {
+	case stateGoingDown:
+		return "GOINGDOWN"
+	case stateGoingUp:
+		return "GOINGUP"
+	default:
+		return "NEUTRAL"
+	}
+}
+
+func flagRune(d bool) rune {
+	if d {
+		return 'X'
+	}
+	return '0'
+}
+
+// tracePrinter writes the classic tab-separated trace table.
+type tracePrinter struct {
+	w io.Writer
+}
+
+func newTracePrinter(w io.Writer) *tracePrinter {
+	fmt.Fprintln(w, "TIME\tSTATE\tFLOOR\tD1\tD2\tD3\tstep\taction")
+	return &tracePrinter{w: w}
+}
+
+func (t *tracePrinter) observe(_ *simulator, e *event) {
+	fmt.Fprintf(t.w, "%04d\t%c\t%d\t%c\t%c\t%c\t%s\t%s\n", e.time, stateRune(e.state), e.floor,
+		flagRune(e.d1), flagRune(e.d2), flagRune(e.d3), e.step, e.action)
+}
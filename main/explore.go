@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kinds of trouble the explore command looks for.
+const (
+	troubleStarved   = "user waits forever"
+	troubleOscillate = "car oscillates"
+	troubleEmpty     = "WAIT list empties"
+)
+
+// A finding is a script of users that leads the simulator into trouble.
+type finding struct {
+	index   int // position of the script in the enumeration
+	trouble string
+	detail  string
+	script  []arrival
+}
+
+// A monitor watches a run for a car that keeps moving without anyone getting
+// in, getting out, or leaving.
+type monitor struct {
+	limit  int // floors the car may pass between two such events
+	moves  int
+	time   int // when the car exceeded the limit, or -1
+	detail string
+}
+
+func (m *monitor) observe(s *simulator, e *event) {
+	if e.explanation {
+		return
+	}
+	switch e.step {
+	case "E7", "E8":
+		m.moves++
+		if m.moves > m.limit && m.time < 0 {
+			m.time = e.time
+			m.detail = fmt.Sprintf("the car passed %d floors by time %d with nobody getting in or out", m.moves, e.time)
+		}
+	case "U1", "U4", "U5", "U6":
+		m.moves = 0
+	}
+}
+
+// explorer enumerates every script of up to a given number of users, whose
+// arrival times lie on a grid, and runs each one.
+type explorer struct {
+	cfg      *config
+	users    int
+	grid     int
+	horizon  int
+	patience int
+	moves    int
+}
+
+// scripts sends every script to the channel: the first user arrives at time 0,
+// and each later user at the same time as the previous one or a multiple of
+// the grid later, up to the horizon.
+func (x *explorer) scripts(out chan<- []arrival) {
+	var extend func(script []arrival)
+	extend = func(script []arrival) {
+		if len(script) > 0 {
+			out <- append([]arrival{}, script...)
+		}
+		if len(script) == x.users {
+			return
+		}
+		first, last := 0, 0
+		if len(script) > 0 {
+			first, last = script[len(script)-1].time, x.horizon
+		}
+		for t := first; t <= last; t += x.grid {
+			for in := 0; in < x.cfg.floors; in++ {
+				for o := 0; o < x.cfg.floors; o++ {
+					if o != in && x.cfg.buttons.check(in, o) == nil {
+						extend(append(script, arrival{time: t, in: in, out: o, giveUpTime: x.patience}))
+					}
+				}
+			}
+		}
+	}
+	extend(nil)
+	close(out)
+}
+
+// check runs a script until long after its last user has arrived and reports
+// the first trouble it finds.
+func (x *explorer) check(script []arrival) (string, string) {
+	cfg := *x.cfg
+	cfg.duration = script[len(script)-1].time + x.patience
+	m := &monitor{limit: x.moves, time: -1}
+	s := newSimulator(&cfg)
+	s.script = script
+	s.observers = append(s.observers, m)
+	if err := s.run(); err != nil {
+		return troubleEmpty, err.Error()
+	}
+	if m.time >= 0 {
+		return troubleOscillate, m.detail
+	}
+	for _, u := range s.users {
+		if u.outcome == "" {
+			where := fmt.Sprintf("in the queue on floor %d", u.in)
+			if u.boarded >= 0 {
+				where = "on board"
+			}
+			detail := fmt.Sprintf("user %d is still %s at time %d", u.id, where, s.time)
+			if s.time < cfg.duration {
+				return troubleEmpty, detail
+			}
+			return troubleStarved, detail
+		}
+	}
+	return "", ""
+}
+
+func (x *explorer) explore(parallel int) (int, []finding) {
+	scripts := make(chan []arrival)
+	go x.scripts(scripts)
+	type job struct {
+		index  int
+		script []arrival
+	}
+	jobs := make(chan job)
+	var mu sync.Mutex
+	var findings []finding
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if trouble, detail := x.check(j.script); trouble != "" {
+					mu.Lock()
+					findings = append(findings, finding{j.index, trouble, detail, j.script})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	n := 0
+	for script := range scripts {
+		jobs <- job{n, script}
+		n++
+	}
+	close(jobs)
+	wg.Wait()
+	sort.Slice(findings, func(i, j int) bool { return findings[i].index < findings[j].index })
+	return n, findings
+}
+
+// The explore command runs every small script of users and reports those in
+// which a user waits forever, the car oscillates, or the WAIT list empties.
+func exploreCommand(args []string) error {
+	cfg := newConfig()
+	x := &explorer{cfg: cfg}
+	fs := flag.NewFlagSet("explore", flag.ExitOnError)
+	fs.IntVar(&x.users, "users", 2, "largest number of users in a script")
+	fs.IntVar(&x.grid, "grid", 50, "spacing of arrival times, in tenths of a second")
+	fs.IntVar(&x.horizon, "horizon", 200, "latest arrival time")
+	fs.IntVar(&x.patience, "patience", 5000, "GIVEUPTIME of every user; each run lasts this long after the last arrival")
+	fs.IntVar(&x.moves, "moves", 0, "floors the car may pass with nobody getting in or out (0 means three trips across the building)")
+	show := fs.Int("show", 3, "number of scripts to print for each kind of trouble")
+	parallel := fs.Int("parallel", runtime.NumCPU(), "number of scripts to run at once")
+	if err := parseFlags(fs, cfg, args); err != nil {
+		return err
+	}
+	if x.users < 1 || x.grid < 1 || x.horizon < 0 || x.patience < 1 || *parallel < 1 {
+		return fmt.Errorf("users, grid, patience, and parallel must be positive")
+	}
+	if x.moves == 0 {
+		x.moves = 3 * (cfg.floors - 1)
+	}
+	n, findings := x.explore(*parallel)
+	fmt.Printf("%d scripts explored, %d in trouble\n", n, len(findings))
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.trouble]++
+		if counts[f.trouble] > *show {
+			continue
+		}
+		fmt.Printf("\n# %s: %s\n", f.trouble, f.detail)
+		if len(cfg.options()) > 0 {
+			fmt.Printf("options %s\n", strings.Join(cfg.options(), " "))
+		}
+		writeScript(os.Stdout, f.script)
+	}
+	if len(counts) > 0 {
+		fmt.Println()
+	}
+	for _, trouble := range []string{troubleStarved, troubleOscillate, troubleEmpty} {
+		if counts[trouble] > 0 {
+			fmt.Printf("%s\t%d\n", trouble, counts[trouble])
+		}
+	}
+	return nil
+}
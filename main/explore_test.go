@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestExplore(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(c *config)
+		moves   int
+		trouble string // expected in the first finding; empty if none
+	}{
+		{"Knuth's elevator", nil, 12, ""},
+		{"full, without pressing again", func(c *config) { c.capacity, c.repress = 1, false }, 12, troubleStarved},
+		{"full, pressing again", func(c *config) { c.capacity = 1 }, 12, ""},
+		{"strict oscillation limit", nil, 2, troubleOscillate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig()
+			if tt.cfg != nil {
+				tt.cfg(cfg)
+			}
+			x := &explorer{cfg: cfg, users: 2, grid: 100, horizon: 200, patience: 5000, moves: tt.moves}
+			n, findings := x.explore(2)
+			if want := 20 + 20*20*3; n != want {
+				t.Errorf("explored %d scripts, want %d", n, want)
+			}
+			switch {
+			case tt.trouble == "" && len(findings) > 0:
+				t.Errorf("%s: %s", findings[0].trouble, findings[0].detail)
+			case tt.trouble != "" && len(findings) == 0:
+				t.Errorf("found no trouble, want %s", tt.trouble)
+			case tt.trouble != "" && findings[0].trouble != tt.trouble:
+				t.Errorf("found %s, want %s", findings[0].trouble, tt.trouble)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// maxEvents bounds the number of events in a checked run, so that actions that
+// keep rescheduling each other at the same time are reported instead of hanging.
+const maxEvents = 100000
+
+// decodeFuzz turns arbitrary bytes into a configuration and a script of users.
+// Missing bytes read as zero, and every value is brought into range, so any
+// input gives a valid run.
+func decodeFuzz(data []byte) (*config, []arrival) {
+	next := func() int {
+		if len(data) == 0 {
+			return 0
+		}
+		b := int(data[0])
+		data = data[1:]
+		return b
+	}
+	cfg := newConfig()
+	cfg.seed = 1
+	cfg.floors = 2 + next()%7
+	cfg.home = next() % cfg.floors
+	cfg.capacity = next() % 4
+	flags := next()
+	cfg.fullLoadBypass = flags&1 != 0
+	cfg.stairsOneFloor = flags&2 != 0
+	cfg.repress = flags&4 == 0
+	if flags&8 != 0 {
+		cfg.policy = "nearest"
+	}
+	if flags&16 != 0 {
+		cfg.boarding = boardingDirection
+	}
+	cfg.cancelCalls = flags&32 != 0
+	cfg.balkLength = next() % 4
+	t := &cfg.timing
+	for _, p := range []*int{&t.quickClose, &t.openDoors, &t.autoClose, &t.inaction, &t.transfer, &t.flutter,
+		&t.closeDoors, &t.accelerate, &t.upFloor, &t.upStop, &t.downFloor, &t.downStop, &t.decide} {
+		*p = 1 + next()%100
+	}
+	var script []arrival
+	time := 0
+	for len(data) > 0 && len(script) < 50 {
+		time += 4 * next()
+		a := arrival{time: time, in: next() % cfg.floors, out: next() % cfg.floors, giveUpTime: 1 + 8*next()}
+		if a.out == a.in {
+			a.out = (a.in + 1) % cfg.floors
+		}
+		script = append(script, a)
+	}
+	cfg.duration = time + 5000
+	return cfg, script
+}
+
+// invariants watches every event of a run for things that must never happen.
+type invariants struct {
+	events   int
+	problems []string
+}
+
+func (v *invariants) observe(s *simulator, e *event) {
+	v.events++
+	if v.events > maxEvents {
+		v.problems = append(v.problems, fmt.Sprintf("more than %d events by time %d", maxEvents, e.time))
+		s.stopped = true
+	}
+	if e.floor < 0 || e.floor >= s.cfg.floors {
+		v.problems = append(v.problems, fmt.Sprintf("time %d: %s: floor %d is outside the building", e.time, e.step, e.floor))
+	}
+	if n := s.ele.stack.length(); n != s.ele.load || (s.cfg.capacity > 0 && n > s.cfg.capacity) {
+		v.problems = append(v.problems, fmt.Sprintf("time %d: %s: %d on board, load %d", e.time, e.step, n, s.ele.load))
+	}
+}
+
+// finish checks at the end of a run that every user either left by U4 or U6
+// (or by walking at once in U2) or is still in a queue or on board.
+func (v *invariants) finish(s *simulator) {
+	where := map[*user]string{}
+	for j, q := range s.ele.queue {
+		for p := q.rlink; p != q; p = p.rlink {
+			where[p.info.(*user)] = fmt.Sprintf("in QUEUE[%d]", j)
+		}
+	}
+	for p := s.ele.stack.rlink; p != s.ele.stack; p = p.rlink {
+		where[p.info.(*user)] = "on board"
+	}
+	for _, u := range s.users {
+		switch {
+		case u.outcome == "" && where[u] == "":
+			v.problems = append(v.problems, fmt.Sprintf("user %d has vanished", u.id))
+		case u.outcome != "" && where[u] != "":
+			v.problems = append(v.problems, fmt.Sprintf("user %d %s but is still %s", u.id, u.outcome, where[u]))
+		case where[u] == fmt.Sprintf("in QUEUE[%d]", u.in) || where[u] == "on board" || where[u] == "":
+		default:
+			v.problems = append(v.problems, fmt.Sprintf("user %d from floor %d is %s", u.id, u.in, where[u]))
+		}
+	}
+}
+
+// checkRun runs a script and returns the invariants it broke.
+func checkRun(cfg *config, script []arrival) []string {
+	v := &invariants{}
+	s := newSimulator(cfg)
+	s.script = append([]arrival{}, script...)
+	s.observers = append(s.observers, v)
+	if err := s.run(); err != nil {
+		v.problems = append(v.problems, err.Error())
+	}
+	v.finish(s)
+	return v.problems
+}
+
+func FuzzSimulator(f *testing.F) {
+	f.Add([]byte{})
+	// Knuth's building and timing, apart from E9 after 100, with the first two users of the book.
+	f.Add([]byte{3, 2, 0, 0, 0, 24, 19, 75, 99, 24, 39, 19, 14, 50, 13, 60, 22, 19, 0, 2, 0, 125, 20, 2, 3, 125})
+	// A car for one, in a hurry.
+	f.Add([]byte{5, 0, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 1, 1, 0, 0, 4, 1, 0, 1, 1, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cfg, script := decodeFuzz(data)
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if problems := checkRun(cfg, script); len(problems) > 0 {
+			t.Fatalf("%s\n\n%s", strings.Join(problems, "\n"), fuzzScenario(cfg, script))
+		}
+	})
+}
+
+// fuzzScenario writes a decoded input as a scenario file.
+func fuzzScenario(cfg *config, script []arrival) string {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# found by FuzzSimulator")
+	fmt.Fprintf(&b, "options %s\n", strings.Join(cfg.options(), " "))
+	writeScript(&b, script)
+	return b.String()
+}
+
+// TestFuzzScenarios turns the inputs that FuzzSimulator has saved as failing
+// (after minimizing them) into scenario files, when run with -update. Each
+// becomes a regression test run by TestScenarios.
+func TestFuzzScenarios(t *testing.T) {
+	if !*update {
+		t.Skip("run with -update to turn saved fuzz inputs into scenarios")
+	}
+	names, _ := filepath.Glob(filepath.Join("testdata", "fuzz", "FuzzSimulator", "*"))
+	for _, name := range names {
+		data, err := readCorpusFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, script := decodeFuzz(data)
+		out := filepath.Join("testdata", "fuzz-"+filepath.Base(name)[:8]+".scenario")
+		if err := os.WriteFile(out, []byte(fuzzScenario(cfg, script)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readCorpusFile reads the []byte value of a file in the format the fuzzer
+// saves its inputs in.
+func readCorpusFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := lines.Text()
+		if strings.HasPrefix(line, "[]byte(") && strings.HasSuffix(line, ")") {
+			s, err := strconv.Unquote(line[len("[]byte(") : len(line)-1])
+			return []byte(s), err
+		}
+	}
+	return nil, fmt.Errorf("%s: no []byte value", name)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A group is a party of users who enter the system together on the same floor,
+// all heading for the same destination, such as people coming back from lunch.
+type group struct {
+	id        int
+	size      int
+	arrival   int // the time at which the group entered the system
+	remaining int // members who have not yet left the system
+	finish    int // the time at which the last member to leave so far reached the destination
+	departure int // the elevator departure that carried the first member who got in (0 if none yet)
+	split     bool
+}
+
+func newGroup(id, size, arrival int) *group {
+	return &group{
+		id:        id,
+		size:      size,
+		arrival:   arrival,
+		remaining: size,
+	}
+}
+
+// groupSize draws the number of users in the next arrival. Without a configured
+// distribution every arrival is a single user and no random number is consumed.
+func (s *simulator) groupSize() int {
+	if len(s.cfg.groupSizes) == 0 {
+		return 1
+	}
+	total := 0.0
+	for _, w := range s.cfg.groupSizes {
+		total += w
+	}
+	r := s.random.arrivals.Float64() * total
+	for i, w := range s.cfg.groupSizes {
+		if r < w {
+			return i + 1
+		}
+		r -= w
+	}
+	return len(s.cfg.groupSizes)
+}
+
+// parseGroupSizes reads a comma-separated list of relative weights for groups of
+// 1, 2, 3, ... users.
+func parseGroupSizes(value string) ([]float64, error) {
+	var weights []float64
+	total := 0.0
+	for _, field := range strings.Split(value, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		if w < 0 {
+			return nil, fmt.Errorf("negative weight %g", w)
+		}
+		weights = append(weights, w)
+		total += w
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("weights must not all be zero")
+	}
+	return weights, nil
+}
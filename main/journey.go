@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// A journey records when a user reached each step. Steps not (yet) reached hold -1.
+type journey struct {
+	arrival int    // entered the system in U1
+	queued  int    // joined QUEUE[IN] in U3
+	boarded int    // got in in U5
+	left    int    // got out in U6, or walked away in U2 or U4
+	finish  int    // reached OUT, by the elevator or by the stairs
+	outcome string // how the journey ended; empty while the user is still in the system
+}
+
+// How a journey ended.
+const (
+	outcomeDelivered = "delivered"
+	outcomeGaveUp    = "gave up"
+	outcomeBalked    = "balked"
+	outcomeStairs    = "took stairs"
+)
+
+func newJourney() journey {
+	return journey{arrival: -1, queued: -1, boarded: -1, left: -1, finish: -1}
+}
+
+// journeyRecord is the exported form of a user's journey.
+type journeyRecord struct {
+	User     int    `json:"user"`
+	Group    int    `json:"group,omitempty"`
+	In       int    `json:"in"`
+	Out      int    `json:"out"`
+	Arrival  int    `json:"arrival"`
+	Queued   int    `json:"queued"`
+	Boarded  int    `json:"boarded"`
+	Alighted int    `json:"alighted"`
+	GaveUp   int    `json:"gaveUp"`
+	Walked   int    `json:"walked"`
+	Finish   int    `json:"finish"`
+	Outcome  string `json:"outcome"`
+	Class    string `json:"class,omitempty"`
+}
+
+func newJourneyRecord(u *user) *journeyRecord {
+	r := &journeyRecord{
+		User:     u.id,
+		In:       u.in,
+		Out:      u.out,
+		Arrival:  u.arrival,
+		Queued:   u.queued,
+		Boarded:  u.boarded,
+		Alighted: -1,
+		GaveUp:   -1,
+		Walked:   -1,
+		Finish:   u.finish,
+		Outcome:  u.outcome,
+		Class:    u.class,
+	}
+	if u.group != nil {
+		r.Group = u.group.id
+	}
+	switch {
+	case u.outcome == outcomeDelivered:
+		r.Alighted = u.left
+	case u.outcome == outcomeGaveUp:
+		r.GaveUp = u.left
+	case u.outcome != "":
+		r.Walked = u.left
+	case u.boarded >= 0:
+		r.Outcome = "on board"
+	default:
+		r.Outcome = "waiting"
+	}
+	return r
+}
+
+func (s *simulator) writeJourneysCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"user", "group", "in", "out", "arrival", "queued", "boarded", "alighted", "gave_up", "walked", "finish", "outcome", "class"})
+	for _, u := range s.users {
+		r := newJourneyRecord(u)
+		c.Write([]string{strconv.Itoa(r.User), strconv.Itoa(r.Group), strconv.Itoa(r.In), strconv.Itoa(r.Out),
+			strconv.Itoa(r.Arrival), strconv.Itoa(r.Queued), strconv.Itoa(r.Boarded), strconv.Itoa(r.Alighted),
+			strconv.Itoa(r.GaveUp), strconv.Itoa(r.Walked), strconv.Itoa(r.Finish), r.Outcome, r.Class})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+func (s *simulator) writeJourneysJSON(w io.Writer) error {
+	records := make([]*journeyRecord, 0, len(s.users))
+	for _, u := range s.users {
+		records = append(records, newJourneyRecord(u))
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(records)
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+// Only a user who gave up has a time in GaveUp; the others who walked have it
+// in Walked.
+func TestJourneyRecordOutcomes(t *testing.T) {
+	tests := []struct {
+		outcome                  string
+		alighted, gaveUp, walked int
+	}{
+		{outcomeDelivered, 50, -1, -1},
+		{outcomeGaveUp, -1, 50, -1},
+		{outcomeBalked, -1, -1, 50},
+		{outcomeStairs, -1, -1, 50},
+		{"", -1, -1, -1},
+	}
+	for _, tt := range tests {
+		u := newUser(1, 0, 2, 100)
+		u.left, u.outcome = 50, tt.outcome
+		r := newJourneyRecord(u)
+		if r.Alighted != tt.alighted || r.GaveUp != tt.gaveUp || r.Walked != tt.walked {
+			t.Errorf("%q: alighted %d, gave up %d, walked %d, want %d, %d, %d",
+				tt.outcome, r.Alighted, r.GaveUp, r.Walked, tt.alighted, tt.gaveUp, tt.walked)
+		}
+	}
+}
@@ -36,8 +36,12 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -91,8 +95,99 @@ const (
 	maxInterTime = 90 * 10 // 90 seconds
 
 	maxTime = 1000 * 10 // stop simulation after 1000 seconds
+
+	walkUpTime   = 15 * 10 // 15 seconds to climb one floor by the stairs
+	walkDownTime = 10 * 10 // 10 seconds to descend one floor by the stairs
 )
 
+// config holds the run-time options that extend Knuth's model. The defaults
+// returned by newConfig reproduce the original behavior.
+type config struct {
+	seed int64 // seed of the random number generator (0 means the clock)
+
+	floors   int    // number of floors in the building
+	home     int    // the home floor, where the elevator waits in E1
+	interMin int    // shortest INTERTIME
+	interMax int    // longest INTERTIME
+	duration int    // the simulation stops at this time
+	timing   timing // how long the elevator's actions take
+
+	capacity       int    // maximum number of people on board the elevator (0 means unlimited)
+	fullLoadBypass bool   // a full elevator does not stop for hall calls in E7 and E8
+	policy         string // name of the policy that chooses the next floor in step D3
+	engine         string // how the coroutines are run: callbacks on the WAIT list or processes
+	explain        bool   // the trace tells which rule fired in DECISION, E2, E7, and E8
+
+	// user behavior
+	balkLength     int     // a user walks at once if QUEUE[IN] holds at least this many people (0 means never)
+	stairsOneFloor bool    // a user walks at once if OUT is next to IN
+	wrongWay       float64 // probability that a user gets into an elevator going the other way
+	repress        bool    // a user left behind presses the call button again after E6 turns it off
+	cancelCalls    bool    // a hall call is turned off when the last user waiting for it gives up
+	boarding       string  // who may get in at E4: anyone (knuth) or only users going the elevator's way (direction)
+
+	groupSizes []float64        // relative weights of arrivals of 1, 2, 3, ... users together (nil means single users)
+	buttons    hallButtons      // the call buttons on each floor (nil means both on every floor)
+	classes    passengerClasses // the mix of users who take their own time to get in and out (nil means none)
+
+	walkUp   int // time to climb one floor by the stairs
+	walkDown int // time to descend one floor by the stairs
+}
+
+func newConfig() *config {
+	return &config{
+		floors:   floors,
+		home:     floorHome,
+		interMin: minInterTime,
+		interMax: maxInterTime,
+		duration: maxTime,
+		timing:   defaultTiming(),
+		policy:   "knuth",
+		engine:   engineCallbacks,
+		wrongWay: 1,
+		repress:  true,
+		boarding: boardingKnuth,
+		walkUp:   walkUpTime,
+		walkDown: walkDownTime,
+	}
+}
+
+// timing is the timing profile of the elevator, in tenths of a second. The
+// defaults are the times given in the steps below.
+type timing struct {
+	quickClose int // U5: until the doors close when a destination is chosen in NEUTRAL
+	openDoors  int // E3: opening the doors
+	autoClose  int // E3: until the doors try to close by themselves in E5
+	inaction   int // E3: until the inaction indicator is set in E9
+	transfer   int // E4: one person getting out or in
+	flutter    int // E5: the doors spring open again while someone is getting out or in
+	closeDoors int // E5: closing the doors
+	accelerate int // E6: building up speed
+	upFloor    int // E7: going up one floor
+	upStop     int // E7: decelerating after going up
+	downFloor  int // E8: going down one floor
+	downStop   int // E8: decelerating after going down
+	decide     int // D2 and D5: until the dormant elevator starts to act
+}
+
+func defaultTiming() timing {
+	return timing{
+		quickClose: 25,
+		openDoors:  20,
+		autoClose:  76,
+		inaction:   300,
+		transfer:   25,
+		flutter:    40,
+		closeDoors: 20,
+		accelerate: 15,
+		upFloor:    51,
+		upStop:     14,
+		downFloor:  61,
+		downStop:   23,
+		decide:     20,
+	}
+}
+
 type node struct {
 	info  interface{}
 	llink *node
@@ -135,6 +230,14 @@ func (x *node) insertLeft(p *node) {
 	x.llink = p
 }
 
+func (x *node) length() int {
+	n := 0
+	for p := x.rlink; p != x; p = p.rlink {
+		n++
+	}
+	return n
+}
+
 func (x *node) delete() {
 	if x == nil {
 		return
@@ -192,7 +295,7 @@ func (x *node) sortIn(w *waitElement) *node {
 	}
 }
 
-//  Subroutine IMMED inserts the current node at the front of the WAIT list.
+// Subroutine IMMED inserts the current node at the front of the WAIT list.
 func (x *node) immed(w *waitElement) *node {
 	n := newNode(w)
 	x.insertRight(n)
@@ -202,7 +305,9 @@ func (x *node) immed(w *waitElement) *node {
 type elevator struct {
 	// On each floor there are two call buttons, one for UP and one for DOWN.
 	// (Actually floor 0 has only UP and floor 4 has only DOWN, but we may ignore
-	// that anomaly since the excess buttons will never be used.) Corresponding to
+	// that anomaly since the excess buttons will never be used. The -buttons
+	// option does not ignore it: it says which buttons each floor has, and users
+	// only ask for the buttons there.) Corresponding to
 	// these buttons, there are ten variables CALLUP[j] and CALLDOWN[j], 0 ≤ j ≤ 4.
 	// There are also variables CALLCAR[j], 0 ≤ j ≤ 4, representing buttons within
 	// the elevator car, which direct it to a destination floor. When a person presses a
@@ -212,9 +317,8 @@ type elevator struct {
 	callDown []bool
 	callCar  []bool
 	floor    int     // the current position of the elevator
-	d1       bool    // false except during the time people are getting in or out of the elevator
+	doors    doors   // the state of the doors, which gives D1 and D3 (see doors.go)
 	d2       bool    // becomes false if the elevator has sat on one floor without moving for 30 sec or more
-	d3       bool    // false except when the doors are open but nobody is getting in or out of the elevator
 	state    int     // the current state of the elevator (GOINGUP, GOINGDOWN, or NEUTRAL)
 	step     int     // constants refer to steps E1--E9
 	elev1    *node   // elevator actions, except for E5 and E9.
@@ -222,15 +326,20 @@ type elevator struct {
 	elev3    *node   // independent elevator action at E9
 	stack    *node   // a stack-like list representing the people now on board the elevator.
 	queue    []*node // linear lists representing the people waiting on each floor
+	load     int     // the number of people on board the elevator
+	departs  int     // the number of times the elevator has left a floor
+
+	doorsSince int  // when the doors last changed state
+	canceled   bool // -cancel turned off a call ahead of the elevator since it last stopped
 }
 
-// Initially FLOOR = 2, D1 = D2 = D3 = 0, and STATE = NEUTRAL.
-func newElevator() *elevator {
+// Initially FLOOR = 2, D1 = D2 = D3 = 0 (the doors are closed), and STATE = NEUTRAL.
+func newElevator(floors, home int) *elevator {
 	e := &elevator{
 		callUp:   make([]bool, floors),
 		callDown: make([]bool, floors),
 		callCar:  make([]bool, floors),
-		floor:    floorHome,
+		floor:    home,
 		state:    stateNeutral,
 		step:     stepWaitForCall,
 		stack:    newDoublyLinkedList(),
@@ -243,27 +352,89 @@ func newElevator() *elevator {
 }
 
 type simulator struct {
-	time   int // simulated time clock (tenths of seconds)
-	userID int // user ID counter
-	random *rand.Rand
-	ele    *elevator
+	time    int // simulated time clock (tenths of seconds)
+	userID  int // user ID counter
+	groupID int // group ID counter
+	random  streams
+	ele     *elevator
+	cfg     *config
+	policy  policy
+	stats   statistics
+	cover   coverage
+	users   []*user   // everyone who has entered the system, in order of arrival
+	script  []arrival // if not nil, the users who enter in U1 instead of random ones
+
+	sampler   *sampler   // takes time-series samples if not nil
+	observers []observer // notified of every step in the trace
+	stopped   bool       // set by an observer to end the run early
+	err       error      // why the run cannot go on, returned by run
 
 	// Each entity waiting for time to pass is placed in a doubly linked
 	// list called the WAIT list; this “agenda” is sorted on the NEXTTIME fields of its
 	// nodes, so that the actions may be processed in the correct sequence of simulated
 	// times.
 	wait *node
+
+	// the process engine (see process.go)
+	current   *process         // the process running now
+	processes []*process       // every process started in this run
+	yield     chan interface{} // a process reports here when it stops running
+	elevator  *process         // the elevator coroutine, activity ELEV1
+	closer    *process         // the independent activity E5, ELEV2
+	inaction  *process         // the independent activity E9, ELEV3
 }
 
-func newSimulator() *simulator {
+// streams are the random number generators of a run, one for each kind of
+// quantity drawn. Each is seeded from the run's seed, so the same passengers
+// with the same patience arrive whatever the controller does, and drawing more
+// or fewer numbers of one kind does not change the others. This makes runs that
+// differ only in their policy or timing a comparison under common random numbers.
+type streams struct {
+	arrivals     *rand.Rand // INTERTIME and the size of each group
+	destinations *rand.Rand // IN and OUT
+	patience     *rand.Rand // GIVEUPTIME
+	behavior     *rand.Rand // whether a user gets in going the wrong way
+	passengers   *rand.Rand // the class of each user
+}
+
+func newStreams(seed int64) streams {
+	stream := func(i int) *rand.Rand {
+		return rand.New(rand.NewSource(deriveSeed(seed, i)))
+	}
+	return streams{
+		arrivals:     stream(0),
+		destinations: stream(1),
+		patience:     stream(2),
+		behavior:     stream(3),
+		passengers:   stream(4),
+	}
+}
+
+func newSimulator(cfg *config) *simulator {
+	seed := cfg.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
 	return &simulator{
 		wait:   newWaitQueue(),
-		random: rand.New(rand.NewSource(time.Now().UnixNano())),
-		ele:    newElevator(),
+		random: newStreams(seed),
+		ele:    newElevator(cfg.floors, cfg.home),
+		cfg:    cfg,
+		policy: policies[cfg.policy],
+		stats:  statistics{doorVisits: [doorStates]int{doorsClosed: 1}}, // the doors start closed
 	}
 }
 
+// The elevator is full when a capacity is configured and that many people are on board.
+func (s *simulator) isFull() bool {
+	return s.cfg.capacity > 0 && s.ele.load >= s.cfg.capacity
+}
+
 func (s *simulator) scheduleElevator(elev **node, delay int, listener waitListener) {
+	if p := s.activity(elev); p != nil {
+		*elev = s.activateAfter(p, delay, nil)
+		return
+	}
 	(*elev).delete()
 	*elev = s.wait.sortIn(newWaitElement(s.time+delay, listener))
 }
@@ -273,22 +444,76 @@ func (s *simulator) scheduleElevatorImmediately(elev **node, listener waitListen
 	*elev = s.wait.immed(newWaitElement(s.time, listener))
 }
 
+// sendElevator sends the elevator to step E3, E4, or E6 after delay units, as
+// DECISION and E5 do. An elevator process is activated with the step.
+func (s *simulator) sendElevator(delay, step int) {
+	if s.elevator != nil {
+		s.activateAfter(s.elevator, delay, step)
+		return
+	}
+	s.scheduleElevator(&s.ele.elev1, delay, newWaitFunc(s.elevatorStep(step)))
+}
+
+// sendElevatorImmediately sends the elevator to step E3 or E4 at once, as U2
+// does.
+func (s *simulator) sendElevatorImmediately(step int) {
+	if s.elevator != nil {
+		s.activate(s.elevator, step)
+		return
+	}
+	s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.elevatorStep(step)))
+}
+
+// elevatorStep is the callback that takes step E3, E4, or E6.
+func (s *simulator) elevatorStep(step int) func() {
+	switch step {
+	case stepOpenDoors:
+		return s.executeOpenDoors
+	case stepLetPeopleOutIn:
+		return s.executeLetPeopleOutIn
+	}
+	return s.executePrepareToMove
+}
+
+// intent is what a user has in mind but never tells the controller directly. The
+// destination is revealed only when the user presses CALLCAR[OUT] in step U5.
+type intent struct {
+	out        int    // the floor to which this user wants to go (OUT ̸= IN)
+	giveUpTime int    // time user will wait for elevator before running out of patience and deciding to walk
+	class      string // the user's passenger class (empty if none)
+	boardTime  int    // time to get in at E4 (0 means the transfer time)
+	alightTime int    // time to get out at E4 (0 means the transfer time)
+}
+
 type user struct {
-	id         int
-	in         int // the floor on which the new user has entered the system
-	out        int // the floor to which this user wants to go (OUT ̸= IN)
-	giveUpTime int // time user will wait for elevator before running out of patience and deciding to walk
-	listNode   *node
-	giveUp     *node
+	id        int
+	in        int    // the floor on which the new user has entered the system
+	direction int    // the hall button pressed in U2 (GOINGUP or GOINGDOWN), the only thing the controller sees
+	wrongWay  bool   // willing to get into an elevator going the other way
+	group     *group // the party this user arrived with (nil if alone)
+	intent
+	journey
+	listNode *node
+	giveUp   *node
+	process  *process // the user's process, with the process engine
 }
 
 func newUser(id, in, out, giveUpTime int) *user {
-	return &user{
-		id:         id,
-		in:         in,
-		out:        out,
-		giveUpTime: giveUpTime,
+	u := &user{
+		id: id,
+		in: in,
+		intent: intent{
+			out:        out,
+			giveUpTime: giveUpTime,
+		},
+		journey: newJourney(),
+	}
+	if out > in {
+		u.direction = stateGoingUp
+	} else {
+		u.direction = stateGoingDown
 	}
+	return u
 }
 
 // U1. [Enter, prepare for successor.] The following quantities are determined in
@@ -300,18 +525,134 @@ func newUser(id, in, out, giveUpTime int) *user {
 // INTERTIME, the amount of time before another user will enter the system.
 // After these quantities have been computed, the simulation program sets
 // things up so that another user enters the system at TIME + INTERTIME.
+// Several users sharing IN and OUT may enter together as a group; each of
+// them has a GIVEUPTIME of their own. A scripted run takes these quantities from
+// the script instead, and nobody enters after its last user. A user can only
+// enter where there is a call button for the trip: a random trip that needs a
+// missing button is drawn again, and counted, and a script that asks for one
+// ends the run with an error.
 func (s *simulator) userEnterPrepareForSuccessor() {
-	s.userID++
-	in := int(s.random.Int31n(floors))
-	out := int(s.random.Int31n(floors - 1))
-	if out >= in {
-		out++
-	}
-	u := newUser(s.userID, in, out, int(minGiveUpTime+s.random.Int31n(maxGiveUpTime-minGiveUpTime)))
-	s.wait.sortIn(newWaitElement(s.time+int(minInterTime+s.random.Int31n(maxInterTime-minInterTime)),
-		newWaitFunc(s.userEnterPrepareForSuccessor)))
+	var a arrival
+	if s.script != nil {
+		a, s.script = s.script[0], s.script[1:]
+		if err := s.cfg.buttons.check(a.in, a.out); err != nil {
+			s.err = fmt.Errorf("time %d: user %d arrives at floor %d going to %d, but %v", s.time, s.userID+1, a.in, a.out, err)
+			return
+		}
+	} else {
+		for {
+			a.in = int(s.random.destinations.Int31n(int32(s.cfg.floors)))
+			a.out = int(s.random.destinations.Int31n(int32(s.cfg.floors - 1)))
+			if a.out >= a.in {
+				a.out++
+			}
+			if s.cfg.buttons.check(a.in, a.out) == nil {
+				break
+			}
+			s.stats.redrawnArrivals++
+		}
+	}
+	var g *group
+	members := make([]*user, s.groupSize())
+	if len(members) > 1 {
+		s.groupID++
+		g = newGroup(s.groupID, len(members), s.time)
+	}
+	for i := range members {
+		s.userID++
+		giveUpTime := a.giveUpTime
+		if s.script == nil {
+			giveUpTime = int(minGiveUpTime + s.random.patience.Int31n(maxGiveUpTime-minGiveUpTime))
+		}
+		u := newUser(s.userID, a.in, a.out, giveUpTime)
+		class := s.cfg.classes.lookup(a.class)
+		if s.script == nil {
+			class = s.passengerClass()
+		}
+		if class != nil {
+			u.class, u.boardTime, u.alightTime = class.name, class.boardTime, class.alightTime
+		}
+		u.wrongWay = s.cfg.wrongWay >= 1 || s.random.behavior.Float64() < s.cfg.wrongWay
+		u.arrival = s.time
+		u.group = g
+		s.stats.arrivals++
+		s.users = append(s.users, u)
+		members[i] = u
+	}
+	if s.script == nil {
+		s.wait.sortIn(newWaitElement(s.time+s.cfg.interMin+int(s.random.arrivals.Int31n(int32(s.cfg.interMax-s.cfg.interMin))),
+			newWaitFunc(s.userEnterPrepareForSuccessor)))
+	} else if len(s.script) > 0 {
+		s.wait.sortIn(newWaitElement(s.script[0].time, newWaitFunc(s.userEnterPrepareForSuccessor)))
+	}
+	for i := len(members) - 1; i >= 0; i-- {
+		s.startUser(members[i])
+	}
+	for _, u := range members {
+		if g == nil {
+			s.printUser(u, userArrives, "U1", "User %d arrives at floor %d, destination is %d.", u.id, u.in, u.out)
+		} else {
+			s.printUser(u, userArrives, "U1", "User %d arrives at floor %d, destination is %d, with group %d.", u.id, u.in, u.out, g.id)
+		}
+	}
+}
+
+// startUser sends a user who has just entered to step U2, or starts the user's
+// process.
+func (s *simulator) startUser(u *user) {
+	if s.cfg.engine == engineProcesses {
+		u.process = s.spawn(func() { s.userProcess(u) })
+		return
+	}
 	s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { s.userSignalAndWait(u) })))
-	s.print("U1", "User %d arrives at floor %d, destination is %d.", u.id, u.in, u.out)
+}
+
+// sendUser sends user u immediately to step U5 or U6, as E4 does. A user process
+// knows which step comes next and is only activated.
+func (s *simulator) sendUser(u *user, step func(u *user)) {
+	if u.process != nil {
+		s.activate(u.process, interrupted{})
+		return
+	}
+	s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { step(u) })))
+}
+
+// Every user leaves the system exactly once, by walking or by getting out of the
+// elevator. A user who walks does not appear again in the simulation, but the
+// journey is taken to end when the stairs bring the user to floor OUT.
+func (s *simulator) userLeave(u *user, walked bool) {
+	finish := s.time
+	u.left = s.time
+	if walked {
+		finish += s.walkTime(u.in, u.out)
+		s.stats.walkers++
+		s.stats.walkJourneyTime += finish - u.arrival
+	} else {
+		s.stats.riderJourneyTime += finish - u.arrival
+	}
+	u.finish = finish
+	if g := u.group; g != nil {
+		g.remaining--
+		if finish > g.finish {
+			g.finish = finish
+		}
+		if g.remaining == 0 {
+			s.stats.groups++
+			s.stats.groupMembers += g.size
+			s.stats.groupJourneyTime += g.finish - g.arrival
+			if g.split {
+				s.stats.splitGroups++
+			}
+		}
+	}
+}
+
+// The time it takes to walk from floor in to floor out by the stairs.
+func (s *simulator) walkTime(in, out int) int {
+	if out > in {
+		return (out - in) * s.cfg.walkUp
+	}
+	return (in - out) * s.cfg.walkDown
 }
 
 // U2. [Signal and wait.] (The purpose of this step is to call for the elevator; some
@@ -330,28 +671,74 @@ func (s *simulator) userEnterPrepareForSuccessor() {
 // position E1, the DECISION subroutine specified below is performed. (The
 // DECISION subroutine is used to take the elevator out of NEUTRAL state at
 // certain critical times.)
+// Before any of this, the user may decide not to wait at all: a one-floor trip
+// can be made by the stairs, and a long queue can be avoided by walking. With
+// the direction boarding rule, only a user who will be let in stops the doors
+// or restarts E4; anyone else presses the call button.
 func (s *simulator) userSignalAndWait(u *user) {
-	if s.ele.floor == u.in && s.ele.step == stepCloseDoors {
-		s.print("U2", "User %d arrives at doors closing and stop them.", u.id)
-		s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeOpenDoors))
-	} else if s.ele.floor == u.in && s.ele.d3 {
-		s.print("U2", "User %d arrives at open doors.", u.id)
-		s.ele.d3 = false
-		s.ele.d1 = true
-		s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeLetPeopleOutIn))
+	if s.cfg.stairsOneFloor && (u.out == u.in+1 || u.out == u.in-1) {
+		s.printUser(u, userWalks, "U2", "User %d takes the stairs, leaves the system.", u.id)
+		s.stats.tookStairs++
+		u.outcome = outcomeStairs
+		s.userLeave(u, true)
+		return
+	}
+	if s.cfg.balkLength > 0 && s.ele.queue[u.in].length() >= s.cfg.balkLength {
+		s.printUser(u, userWalks, "U2", "User %d sees a long queue, walks, leaves the system.", u.id)
+		s.stats.balked++
+		u.outcome = outcomeBalked
+		s.userLeave(u, true)
+		return
+	}
+	admitted := s.cfg.boarding == boardingKnuth || s.mayBoard(u)
+	if s.ele.floor == u.in && s.ele.step == stepCloseDoors && admitted {
+		s.printUser(u, userWaits, "U2", "User %d arrives at doors closing and stop them.", u.id)
+		s.cover[branchDoorsClosing]++
+		s.sendElevatorImmediately(stepOpenDoors)
+	} else if s.ele.floor == u.in && s.ele.doors.d3() && admitted {
+		s.printUser(u, userWaits, "U2", "User %d arrives at open doors.", u.id)
+		s.cover[branchDoorsOpen]++
+		s.setDoors(doorsOpenBoarding)
+		s.sendElevatorImmediately(stepLetPeopleOutIn)
 	} else {
-		if u.out > u.in {
-			s.print("U2", "User %d presses up button.", u.id)
+		if u.direction == stateGoingUp {
+			s.printUser(u, userWaits, "U2", "User %d presses up button.", u.id)
 			s.ele.callUp[u.in] = true
 		} else {
-			s.print("U2", "User %d presses down button.", u.id)
+			s.printUser(u, userWaits, "U2", "User %d presses down button.", u.id)
 			s.ele.callDown[u.in] = true
 		}
 		if !s.ele.d2 || s.ele.step == stepWaitForCall {
 			s.decision()
 		}
 	}
-	s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { s.userEnterQueue(u) })))
+	if u.process == nil {
+		s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { s.userEnterQueue(u) })))
+	}
+}
+
+// U2'. [Signal again.] A user still standing in QUEUE[IN] after the elevator has
+// left without them (because it was full) presses the call button again if step E6
+// turned its light off.
+func (s *simulator) userSignalAgain(u *user) {
+	if u.direction == stateGoingUp {
+		if s.ele.callUp[u.in] {
+			return
+		}
+		s.printUser(u, userWaits, "U2", "User %d presses up button again.", u.id)
+		s.ele.callUp[u.in] = true
+		s.stats.repressed++
+	} else {
+		if s.ele.callDown[u.in] {
+			return
+		}
+		s.printUser(u, userWaits, "U2", "User %d presses down button again.", u.id)
+		s.ele.callDown[u.in] = true
+		s.stats.repressed++
+	}
+	if !s.ele.d2 || s.ele.step == stepWaitForCall {
+		s.decision()
+	}
 }
 
 // U3. [Enter queue.] Insert this user at the rear of QUEUE[IN], which is a linear
@@ -360,10 +747,13 @@ func (s *simulator) userSignalAndWait(u *user) {
 // more precisely, unless step E4 of the elevator routine below sends this user
 // to U5 and cancels the scheduled activity U4.
 func (s *simulator) userEnterQueue(u *user) {
-	s.print("U3", "User %d stands in queue in front of elevator.", u.id)
+	s.printUser(u, userWaits, "U3", "User %d stands in queue in front of elevator.", u.id)
+	u.queued = s.time
 	u.listNode = newNode(u)
 	s.ele.queue[u.in].insertLeft(u.listNode) // enqueue left
-	u.giveUp = s.wait.sortIn(newWaitElement(s.time+u.giveUpTime, newWaitFunc(func() { s.userGiveUp(u) })))
+	if u.process == nil {
+		u.giveUp = s.wait.sortIn(newWaitElement(s.time+u.giveUpTime, newWaitFunc(func() { s.userGiveUp(u) })))
+	}
 }
 
 // U4. [Give up.] If FLOOR ̸= IN or D1 = 0, delete this user from QUEUE[IN]
@@ -372,11 +762,49 @@ func (s *simulator) userEnterQueue(u *user) {
 // FLOOR = IN and D1 ̸= 0, the user stays and waits (knowing that the wait
 // won’t be long).
 func (s *simulator) userGiveUp(u *user) {
-	if s.ele.floor != u.in || !s.ele.d1 {
-		s.print("U4", "User %d decides to give up, leaves the system.", u.id)
+	if s.ele.floor != u.in || !s.ele.doors.d1() {
+		s.printUser(u, userWalks, "U4", "User %d decides to give up, leaves the system.", u.id)
 		u.listNode.delete()
+		s.stats.gaveUp++
+		u.outcome = outcomeGaveUp
+		s.userLeave(u, true)
+		if s.cfg.cancelCalls {
+			s.cancelOrphanedCall(u)
+		}
 	} else {
-		s.print("U4", "User %d almost gave up, but stays and waits.", u.id)
+		s.printUser(u, userWaits, "U4", "User %d almost gave up, but stays and waits.", u.id)
+		s.cover[branchAlmostGaveUp]++
+	}
+}
+
+// cancelOrphanedCall turns off the hall call that user u pressed in U2 once
+// nobody is left on floor IN waiting to go the same way. Otherwise the elevator
+// would still stop there for nobody. If the elevator was on its way to that
+// call, it notes so, and E7 or E8 stops it at the next floor if nothing else
+// lies ahead.
+func (s *simulator) cancelOrphanedCall(u *user) {
+	q := s.ele.queue[u.in]
+	for p := q.rlink; p != q; p = p.rlink {
+		if p.info.(*user).direction == u.direction {
+			return
+		}
+	}
+	call, name := s.ele.callUp, "CALLUP"
+	if u.direction == stateGoingDown {
+		call, name = s.ele.callDown, "CALLDOWN"
+	}
+	if call[u.in] {
+		call[u.in] = false
+		s.stats.canceledCalls++
+		s.explain("U4", "Nobody left waiting for %s[%d], which is turned off.", name, u.in)
+		above, below := u.in > s.ele.floor, u.in < s.ele.floor
+		if s.ele.step == stepGoUpAFloor || s.ele.step == stepGoDownAFloor {
+			// moving, FLOOR is already the floor the elevator is coming to
+			above, below = u.in >= s.ele.floor, u.in <= s.ele.floor
+		}
+		if s.ele.state == stateGoingUp && above || s.ele.state == stateGoingDown && below {
+			s.ele.canceled = true
+		}
 	}
 }
 
@@ -393,26 +821,40 @@ func (s *simulator) userGiveUp(u *user) {
 // Now the user waits until being sent to step U6 by step E4 below, when
 // the elevator has reached the desired floor.
 func (s *simulator) userGetIn(u *user) {
-	s.print("U5", "User %d gets in.", u.id)
+	s.printUser(u, userBoards, "U5", "User %d gets in.", u.id)
 	u.listNode.delete()
 	u.giveUp.delete()
 	s.ele.stack.insertLeft(u.listNode) // push left
+	s.ele.load++
+	u.boarded = s.time
+	s.stats.boarded++
+	s.stats.waitTime += s.time - u.arrival
+	if s.ele.state != stateNeutral && s.ele.state != u.direction {
+		s.stats.wrongWayBoardings++
+	}
+	if g := u.group; g != nil {
+		if g.departure == 0 {
+			g.departure = s.ele.departs + 1
+		} else if g.departure != s.ele.departs+1 {
+			g.split = true
+		}
+	}
 	s.ele.callCar[u.out] = true
 	if s.ele.state == stateNeutral {
-		if u.out > u.in {
-			s.ele.state = stateGoingUp
-		} else {
-			s.ele.state = stateGoingDown
-		}
-		s.scheduleElevator(&s.ele.elev2, 25, newWaitFunc(s.executeCloseDoors))
+		s.ele.state = u.direction
+		s.scheduleElevator(&s.ele.elev2, s.cfg.timing.quickClose, newWaitFunc(s.executeCloseDoors))
 	}
 }
 
 // U6. [Get out.] Delete this user from the ELEVATOR list and from the simulated
 // system.
 func (s *simulator) userGetOut(u *user) {
-	s.print("U6", "User %d gets out, leaves the system.", u.id)
+	s.printUser(u, userAlights, "U6", "User %d gets out, leaves the system.", u.id)
 	u.listNode.delete()
+	s.ele.load--
+	s.stats.delivered++
+	u.outcome = outcomeDelivered
+	s.userLeave(u, false)
 }
 
 // E1. [Wait for call.] (At this point the elevator is sitting at floor 2 with the doors
@@ -424,7 +866,7 @@ func (s *simulator) executeWaitForCall() {
 }
 
 func (s *simulator) isAllCallsAboveFalse() bool {
-	for j := s.ele.floor + 1; j < floors; j++ {
+	for j := s.ele.floor + 1; j < s.cfg.floors; j++ {
 		if s.ele.callUp[j] || s.ele.callDown[j] || s.ele.callCar[j] {
 			return false
 		}
@@ -441,34 +883,111 @@ func (s *simulator) isAllCallsBelowFalse() bool {
 	return true
 }
 
+func (s *simulator) isCarCalledAbove() bool {
+	for j := s.ele.floor + 1; j < s.cfg.floors; j++ {
+		if s.ele.callCar[j] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *simulator) isCarCalledBelow() bool {
+	for j := s.ele.floor - 1; j >= 0; j-- {
+		if s.ele.callCar[j] {
+			return true
+		}
+	}
+	return false
+}
+
 // E2. [Change of state?] If STATE = GOINGUP and CALLUP[j] = CALLDOWN[j] =
 // CALLCAR[j] = 0 for all j > FLOOR, then set STATE ← NEUTRAL or STATE ←
 // GOINGDOWN, according as CALLCAR[j] = 0 for all j < FLOOR or not, and set
 // all CALL variables for the current floor to zero. If STATE = GOINGDOWN, do
 // similar actions with directions reversed.
+// With the direction boarding rule, the hall call for the direction the
+// elevator is not taking stays lit. And if the elevator stopped for a hall call
+// in its own direction, it keeps that direction until the users who pressed it
+// are in, rather than turning for calls behind it and refusing them.
 func (s *simulator) executeChangeOfState() {
+	s.changeOfState()
+	s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeOpenDoors))
+}
+
+func (s *simulator) changeOfState() {
 	s.print("E2", "Elevator stops.")
 	s.ele.step = stepChangeOfState
+	if s.isPhantomStop() {
+		s.stats.phantomStops++
+	}
 	if s.ele.state == stateGoingUp && s.isAllCallsAboveFalse() {
 		if s.isAllCallsBelowFalse() {
 			s.ele.state = stateNeutral
+			s.explain("E2", "No calls above or below, STATE ← NEUTRAL, calls on floor %d cleared.", s.ele.floor)
+		} else if s.cfg.boarding == boardingDirection && s.ele.callUp[s.ele.floor] {
+			s.explain("E2", "No calls above but CALLUP[%d], STATE stays GOINGUP, calls on floor %d cleared.", s.ele.floor, s.ele.floor)
 		} else {
 			s.ele.state = stateGoingDown
+			s.explain("E2", "No calls above but some below, STATE ← GOINGDOWN, calls on floor %d cleared.", s.ele.floor)
 		}
-		s.ele.callUp[s.ele.floor] = false
-		s.ele.callDown[s.ele.floor] = false
-		s.ele.callCar[s.ele.floor] = false
+		s.clearCallsHere()
 	} else if s.ele.state == stateGoingDown && s.isAllCallsBelowFalse() {
 		if s.isAllCallsAboveFalse() {
 			s.ele.state = stateNeutral
+			s.explain("E2", "No calls below or above, STATE ← NEUTRAL, calls on floor %d cleared.", s.ele.floor)
+		} else if s.cfg.boarding == boardingDirection && s.ele.callDown[s.ele.floor] {
+			s.explain("E2", "No calls below but CALLDOWN[%d], STATE stays GOINGDOWN, calls on floor %d cleared.", s.ele.floor, s.ele.floor)
 		} else {
 			s.ele.state = stateGoingUp
+			s.explain("E2", "No calls below but some above, STATE ← GOINGUP, calls on floor %d cleared.", s.ele.floor)
 		}
+		s.clearCallsHere()
+	} else if s.ele.state == stateNeutral {
+		s.explain("E2", "STATE is NEUTRAL, nothing to change.")
+	} else {
+		s.explain("E2", "Calls ahead, STATE stays %s.", stateName(s.ele.state))
+	}
+}
+
+// clearCallsHere turns off the calls on the floor where E2 changes the state.
+// With the direction rule, only the hall call for the elevator's direction is
+// turned off: the users who pressed the other will not be let in, and in
+// NEUTRAL the first user to get in sets a direction that may refuse the rest.
+// E6 turns off the calls the elevator leaves behind as Knuth's E6 does.
+func (s *simulator) clearCallsHere() {
+	s.ele.callCar[s.ele.floor] = false
+	if s.cfg.boarding == boardingKnuth || s.ele.state == stateGoingUp {
 		s.ele.callUp[s.ele.floor] = false
+	}
+	if s.cfg.boarding == boardingKnuth || s.ele.state == stateGoingDown {
 		s.ele.callDown[s.ele.floor] = false
-		s.ele.callCar[s.ele.floor] = false
 	}
-	s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeOpenDoors))
+}
+
+// turnIfNothingAhead sets STATE as E2 does when there are no calls ahead of the
+// elevator.
+func (s *simulator) turnIfNothingAhead() {
+	below, above := !s.isAllCallsBelowFalse(), !s.isAllCallsAboveFalse()
+	switch {
+	case s.ele.state == stateGoingUp && !above && below:
+		s.ele.state = stateGoingDown
+		s.explain("E6", "No calls above but some below, STATE ← GOINGDOWN.")
+	case s.ele.state == stateGoingDown && !below && above:
+		s.ele.state = stateGoingUp
+		s.explain("E6", "No calls below but some above, STATE ← GOINGUP.")
+	case s.ele.state != stateNeutral && !above && !below:
+		s.ele.state = stateNeutral
+		s.explain("E6", "No calls above or below, STATE ← NEUTRAL.")
+	}
+}
+
+// A phantom stop is one made for a hall call when nobody is waiting on the floor
+// and nobody on board wants to get out there: everyone who pressed the call has
+// given up.
+func (s *simulator) isPhantomStop() bool {
+	j := s.ele.floor
+	return (s.ele.callUp[j] || s.ele.callDown[j]) && !s.ele.callCar[j] && s.ele.queue[j].rlink == s.ele.queue[j]
 }
 
 // E3. [Open doors.] Set D1 and D2 to any nonzero values. Set elevator activity
@@ -478,13 +997,21 @@ func (s *simulator) executeChangeOfState() {
 // E5 to start up independently after 76 units of time. Then wait 20 units of
 // time (to simulate opening of the doors) and go to E4.
 func (s *simulator) executeOpenDoors() {
+	s.openDoors()
+	s.scheduleElevator(&s.ele.elev1, s.cfg.timing.openDoors, newWaitFunc(s.executeLetPeopleOutIn))
+}
+
+func (s *simulator) openDoors() {
 	s.print("E3", "Elevator doors start to open.")
 	s.ele.step = stepOpenDoors
-	s.ele.d1 = true
+	if s.ele.doors == doorsClosed {
+		s.setDoors(doorsOpening)
+	} else {
+		s.setDoors(doorsReopening)
+	}
 	s.ele.d2 = true
-	s.scheduleElevator(&s.ele.elev3, 300, newWaitFunc(s.executeSetInactionIndicator))
-	s.scheduleElevator(&s.ele.elev2, 76, newWaitFunc(s.executeCloseDoors))
-	s.scheduleElevator(&s.ele.elev1, 20, newWaitFunc(s.executeLetPeopleOutIn))
+	s.scheduleElevator(&s.ele.elev3, s.cfg.timing.inaction, newWaitFunc(s.executeSetInactionIndicator))
+	s.scheduleElevator(&s.ele.elev2, s.cfg.timing.autoClose, newWaitFunc(s.executeCloseDoors))
 }
 
 // E4. [Let people out, in.] If anyone in the ELEVATOR list has OUT = FLOOR, send
@@ -495,7 +1022,20 @@ func (s *simulator) executeOpenDoors() {
 // is empty, set D1 ← 0, make D3 nonzero, and wait for some other activity
 // to initiate further action. (Step E5 will send us to E6, or step U2 will
 // restart E4.)
+// If the elevator is full, the people in QUEUE[FLOOR] cannot get in; they are
+// treated as if the queue were empty and remain waiting on the floor. The front
+// person is the first one in the queue who is willing to get in: a user may
+// refuse an elevator going the other way. A user of a passenger class takes
+// the time of the class instead of 25 units.
 func (s *simulator) executeLetPeopleOutIn() {
+	if d := s.letPeopleOutIn(); d > 0 {
+		s.scheduleElevator(&s.ele.elev1, d, newWaitFunc(s.executeLetPeopleOutIn))
+	}
+}
+
+// letPeopleOutIn takes step E4 and returns how long to wait before repeating
+// it, or 0 if nobody is getting out or in.
+func (s *simulator) letPeopleOutIn() int {
 	s.ele.step = stepLetPeopleOutIn
 	p := s.ele.stack
 	for {
@@ -505,29 +1045,56 @@ func (s *simulator) executeLetPeopleOutIn() {
 		} else {
 			u := p.info.(*user)
 			if u.out == s.ele.floor {
+				s.setDoors(doorsOpenBoarding)
 				s.print("E4", "Doors are open. Users about to exit.")
-				s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { s.userGetOut(u) })))
-				s.scheduleElevator(&s.ele.elev1, 25, newWaitFunc(s.executeLetPeopleOutIn))
-				return
+				s.sendUser(u, s.userGetOut)
+				return s.transfer(s.transferTime(u.alightTime))
 			}
 		}
 	}
+	if s.isFull() && s.ele.queue[s.ele.floor].rlink != s.ele.queue[s.ele.floor] {
+		s.print("E4", "Doors are open. Elevator is full.")
+		s.setDoors(doorsOpenIdle)
+		return 0
+	}
 	p = s.ele.queue[s.ele.floor]
 	for {
 		p = p.rlink // dequeue right
 		if p == s.ele.queue[s.ele.floor] {
 			break
-		} else {
+		} else if u := p.info.(*user); s.mayBoard(u) {
+			s.setDoors(doorsOpenBoarding)
 			s.print("E4", "Doors are open. Users about to enter.")
-			u := p.info.(*user)
-			s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { s.userGetIn(u) })))
-			s.scheduleElevator(&s.ele.elev1, 25, newWaitFunc(s.executeLetPeopleOutIn))
-			return
+			s.sendUser(u, s.userGetIn)
+			return s.transfer(s.transferTime(u.boardTime))
 		}
 	}
 	s.print("E4", "Doors are open. Nobody outside elevator.")
-	s.ele.d1 = false
-	s.ele.d3 = true
+	s.setDoors(doorsOpenIdle)
+	return 0
+}
+
+// transfer counts d units that E4 waits for someone to get out or in.
+func (s *simulator) transfer(d int) int {
+	s.stats.transfers++
+	s.stats.transferTime += d
+	return d
+}
+
+// The boarding rules of E4.
+const (
+	boardingKnuth     = "knuth"
+	boardingDirection = "direction"
+)
+
+// mayBoard tells whether user u gets in at E4. Knuth lets anyone in, though a
+// user may refuse an elevator going the other way; with the direction rule,
+// the elevator admits only users going its way, or anyone when it is NEUTRAL.
+func (s *simulator) mayBoard(u *user) bool {
+	if s.ele.state == stateNeutral || s.ele.state == u.direction {
+		return true
+	}
+	return s.cfg.boarding == boardingKnuth && u.wrongWay
 }
 
 // E5. [Close doors.] If D1 ̸= 0, wait 40 units and repeat this step (the doors flutter
@@ -537,15 +1104,24 @@ func (s *simulator) executeLetPeopleOutIn() {
 // in or out; but if a new user enters on this floor while the doors are closing,
 // they will open again as stated in step U2.)
 func (s *simulator) executeCloseDoors() {
+	if s.closeDoors() {
+		s.scheduleElevator(&s.ele.elev2, s.cfg.timing.flutter, newWaitFunc(s.executeCloseDoors))
+	}
+}
+
+// closeDoors takes step E5 and reports whether the doors fluttered, so that the
+// step is to be repeated.
+func (s *simulator) closeDoors() bool {
 	s.ele.step = stepCloseDoors
-	if s.ele.d1 {
+	if s.ele.doors.d1() {
 		s.print("E5", "Doors flutter.")
-		s.scheduleElevator(&s.ele.elev2, 40, newWaitFunc(s.executeCloseDoors))
-	} else {
-		s.print("E5", "Elevator doors start to close.")
-		s.ele.d3 = false
-		s.scheduleElevator(&s.ele.elev1, 20, newWaitFunc(s.executePrepareToMove))
+		s.cover[branchFlutter]++
+		return true
 	}
+	s.print("E5", "Elevator doors start to close.")
+	s.setDoors(doorsClosing)
+	s.sendElevator(s.cfg.timing.closeDoors, stepPrepareToMove)
+	return false
 }
 
 // E6. [Prepare to move.] Set CALLCAR[FLOOR] to zero; also set CALLUP[FLOOR]
@@ -557,8 +1133,25 @@ func (s *simulator) executeCloseDoors() {
 // to E1. Otherwise, if D2 ̸= 0, cancel the elevator activity E9. Finally, if
 // STATE = GOINGUP, wait 15 units of time (for the elevator to build up speed)
 // and go to E7; if STATE = GOINGDOWN, wait 15 units and go to E8.
+// Anyone left behind in QUEUE[FLOOR] is sent to step U2' to press the call
+// button again (unless users are configured not to do that). With the direction
+// boarding rule, E2 may have kept a direction with nothing ahead for users who
+// then did not get in; the elevator turns as E2 would otherwise have done.
 func (s *simulator) executePrepareToMove() {
+	s.prepareToMove()
+	switch s.ele.state {
+	case stateNeutral:
+		s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeWaitForCall))
+	case stateGoingUp:
+		s.scheduleElevator(&s.ele.elev1, s.cfg.timing.accelerate, newWaitFunc(s.executeGoUpAFloor))
+	default:
+		s.scheduleElevator(&s.ele.elev1, s.cfg.timing.accelerate, newWaitFunc(s.executeGoDownAFloor))
+	}
+}
+
+func (s *simulator) prepareToMove() {
 	s.ele.step = stepPrepareToMove
+	s.setDoors(doorsClosed)
 	s.ele.callCar[s.ele.floor] = false
 	if s.ele.state != stateGoingDown {
 		s.ele.callUp[s.ele.floor] = false
@@ -566,21 +1159,29 @@ func (s *simulator) executePrepareToMove() {
 	if s.ele.state != stateGoingUp {
 		s.ele.callDown[s.ele.floor] = false
 	}
+	for p := s.ele.queue[s.ele.floor].llink; p != s.ele.queue[s.ele.floor]; p = p.llink {
+		u := p.info.(*user)
+		s.stats.leftBehind++
+		if s.cfg.repress {
+			s.wait.immed(newWaitElement(s.time, newWaitFunc(func() { s.userSignalAgain(u) })))
+		}
+	}
+	if s.cfg.boarding == boardingDirection {
+		s.turnIfNothingAhead()
+	}
 	s.decision()
 	if s.ele.state == stateNeutral {
 		s.print("E6", "Elevator about to go dormant")
-		s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeWaitForCall))
+		return
+	}
+	if s.ele.d2 {
+		s.ele.elev3.delete()
+	}
+	s.ele.departs++
+	if s.ele.state == stateGoingUp {
+		s.print("E6", "Elevator about to go up")
 	} else {
-		if s.ele.d2 {
-			s.ele.elev3.delete()
-		}
-		if s.ele.state == stateGoingUp {
-			s.print("E6", "Elevator about to go up")
-			s.scheduleElevator(&s.ele.elev1, 15, newWaitFunc(s.executeGoUpAFloor))
-		} else {
-			s.print("E6", "Elevator about to go down")
-			s.scheduleElevator(&s.ele.elev1, 15, newWaitFunc(s.executeGoDownAFloor))
-		}
+		s.print("E6", "Elevator about to go down")
 	}
 }
 
@@ -589,17 +1190,18 @@ func (s *simulator) executePrepareToMove() {
 // CALLDOWN[FLOOR] = 1) and CALLUP[j] = CALLDOWN[j] = CALLCAR[j] = 0
 // for all j > FLOOR), wait 14 units (for deceleration) and go to E2. Otherwise,
 // repeat this step.
+// With the full load bypass enabled, a full elevator ignores CALLUP[FLOOR] and
+// CALLDOWN[FLOOR] since nobody could get in anyway, but only while a CALLCAR
+// further on will stop it; otherwise it could pass the last call in its way and
+// leave the building.
 func (s *simulator) executeGoUpAFloor() {
-	s.print("E7", "Elevator moving up")
-	s.ele.step = stepGoUpAFloor
-	s.ele.floor++
-	s.scheduleElevator(&s.ele.elev1, 51, newWaitFunc(s.executeGoUpAFloor2))
+	s.goAFloor(stateGoingUp)
+	s.scheduleElevator(&s.ele.elev1, s.cfg.timing.upFloor, newWaitFunc(s.executeGoUpAFloor2))
 }
 
 func (s *simulator) executeGoUpAFloor2() {
-	if s.ele.callCar[s.ele.floor] || s.ele.callUp[s.ele.floor] ||
-		((s.ele.floor == 2 || s.ele.callDown[s.ele.floor]) && s.isAllCallsAboveFalse()) {
-		s.scheduleElevator(&s.ele.elev1, 14, newWaitFunc(s.executeChangeOfState))
+	if s.isStopCalled(stateGoingUp) {
+		s.scheduleElevator(&s.ele.elev1, s.cfg.timing.upStop, newWaitFunc(s.executeChangeOfState))
 	} else {
 		s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeGoUpAFloor))
 	}
@@ -609,26 +1211,87 @@ func (s *simulator) executeGoUpAFloor2() {
 // the times 51 and 14 are changed to 61 and 23, respectively. (It takes the
 // elevator longer to go down than up.)
 func (s *simulator) executeGoDownAFloor() {
-	s.print("E8", "Elevator moving down")
-	s.ele.step = stepGoDownAFloor
-	s.ele.floor--
-	s.scheduleElevator(&s.ele.elev1, 61, newWaitFunc(s.executeGoDownAFloor2))
+	s.goAFloor(stateGoingDown)
+	s.scheduleElevator(&s.ele.elev1, s.cfg.timing.downFloor, newWaitFunc(s.executeGoDownAFloor2))
 }
 
 func (s *simulator) executeGoDownAFloor2() {
-	if s.ele.callCar[s.ele.floor] || s.ele.callDown[s.ele.floor] ||
-		((s.ele.floor == 2 || s.ele.callUp[s.ele.floor]) && s.isAllCallsBelowFalse()) {
-		s.scheduleElevator(&s.ele.elev1, 23, newWaitFunc(s.executeChangeOfState))
+	if s.isStopCalled(stateGoingDown) {
+		s.scheduleElevator(&s.ele.elev1, s.cfg.timing.downStop, newWaitFunc(s.executeChangeOfState))
 	} else {
 		s.scheduleElevatorImmediately(&s.ele.elev1, newWaitFunc(s.executeGoDownAFloor))
 	}
 }
 
+// goAFloor begins step E7 or E8: FLOOR moves to the next floor in the direction.
+func (s *simulator) goAFloor(direction int) {
+	if direction == stateGoingUp {
+		s.print("E7", "Elevator moving up")
+		s.ele.step = stepGoUpAFloor
+		s.ele.floor++
+	} else {
+		s.print("E8", "Elevator moving down")
+		s.ele.step = stepGoDownAFloor
+		s.ele.floor--
+	}
+	s.countWrongWayFloors(direction)
+}
+
+// countWrongWayFloors counts, for everyone on board, a floor just traveled away
+// from their destination.
+func (s *simulator) countWrongWayFloors(direction int) {
+	for p := s.ele.stack.rlink; p != s.ele.stack; p = p.rlink {
+		u := p.info.(*user)
+		if direction == stateGoingUp && u.out < s.ele.floor || direction == stateGoingDown && u.out > s.ele.floor {
+			s.stats.wrongWayFloors++
+		}
+	}
+}
+
+// isStopCalled is the test of E7 when going up and of E8 when going down: whether
+// the elevator, having just reached FLOOR, stops there.
+func (s *simulator) isStopCalled(direction int) bool {
+	j := s.ele.floor
+	ahead, behind := s.ele.callUp, s.ele.callDown
+	step, aheadName, behindName, beyond := "E7", "CALLUP", "CALLDOWN", "above"
+	clear, carCalled := s.isAllCallsAboveFalse(), s.isCarCalledAbove()
+	if direction == stateGoingDown {
+		ahead, behind = behind, ahead
+		step, aheadName, behindName, beyond = "E8", behindName, aheadName, "below"
+		clear, carCalled = s.isAllCallsBelowFalse(), s.isCarCalledBelow()
+	}
+	hall := !(s.cfg.fullLoadBypass && s.isFull() && carCalled)
+	stop := true
+	switch {
+	case s.ele.callCar[j]:
+		s.explain(step, "Stop because CALLCAR[%d].", j)
+	case hall && ahead[j]:
+		s.explain(step, "Stop because %s[%d].", aheadName, j)
+	case j == s.cfg.home && clear:
+		s.explain(step, "Stop at the home floor %d with nothing %s.", j, beyond)
+	case hall && behind[j] && clear:
+		s.explain(step, "Stop because %s[%d] and nothing %s.", behindName, j, beyond)
+	case ahead[j] || (behind[j] && clear):
+		s.explain(step, "Pass floor %d: full, hall calls ignored while CALLCAR is set further on.", j)
+		stop = false
+	case clear && s.ele.canceled:
+		s.explain(step, "Stop because the calls %s were canceled.", beyond)
+	default:
+		s.explain(step, "Pass floor %d: no call here.", j)
+		stop = false
+	}
+	if stop {
+		s.ele.canceled = false
+	}
+	return stop
+}
+
 // E9. [Set inaction indicator.] Set D2 ← 0 and perform the DECISION subroutine.
 // (This independent action is initiated in step E3 but it is almost always
 // canceled in step E6. See exercise 4.)
 func (s *simulator) executeSetInactionIndicator() {
 	s.print("E9", "Elevator not active")
+	s.cover[branchInaction]++
 	s.ele.d2 = false
 	s.decision()
 }
@@ -640,6 +1303,7 @@ func (s *simulator) decision() {
 
 	// D1. [Decision necessary?] If STATE ̸= NEUTRAL, exit from this subroutine.
 	if s.ele.state != stateNeutral {
+		s.explain("D1", "STATE is %s, no decision necessary.", stateName(s.ele.state))
 		return
 	}
 
@@ -648,8 +1312,11 @@ func (s *simulator) decision() {
 	// its activity E3 after 20 units of time, and exit from this subroutine. (If
 	// the DECISION subroutine is currently being invoked by the independent
 	// activity E9, it is possible for the elevator coroutine to be positioned at E1.)
-	if s.ele.step == stepWaitForCall && (s.ele.callUp[floorHome] || s.ele.callCar[floorHome] || s.ele.callDown[floorHome]) {
-		s.scheduleElevator(&s.ele.elev1, 20, newWaitFunc(s.executeOpenDoors))
+	home := s.cfg.home
+	if s.ele.step == stepWaitForCall && (s.ele.callUp[home] || s.ele.callCar[home] || s.ele.callDown[home]) {
+		s.explain("D2", "Dormant with a call on floor %d, E3 in %d.", home, s.cfg.timing.decide)
+		s.cover[branchDormantHome]++
+		s.sendElevator(s.cfg.timing.decide, stepOpenDoors)
 		return
 	}
 
@@ -657,83 +1324,326 @@ func (s *simulator) decision() {
 	// or CALLDOWN[j] is nonzero, and go on to step D4. But if no such j exists,
 	// then set j ← 2 if the DECISION subroutine is currently being invoked by
 	// step E6; otherwise exit from this subroutine.
-	j := 0
-	for ; j < floors; j++ {
-		if j != s.ele.floor && (s.ele.callUp[j] || s.ele.callCar[j] || s.ele.callDown[j]) {
-			goto D4
+	// (The choice of j is delegated to the configured policy, which sees only the
+	// buttons; knuthPolicy is the rule above.)
+	j, ok := s.policy.target(s.view())
+	if !ok {
+		if s.ele.step == stepPrepareToMove {
+			j = home
+			s.explain("D3", "No calls, invoked from E6, j ← %d.", j)
+			s.cover[branchNoCallsHome]++
+		} else {
+			s.explain("D3", "No calls, not invoked from E6, exit.")
+			return
 		}
-	}
-	if s.ele.step == stepPrepareToMove {
-		j = 2
 	} else {
-		return
+		s.explain("D3", "Call on floor %d, chosen by the %s policy, j ← %d.", j, s.cfg.policy, j)
 	}
 
-D4: // D4. [Set STATE.] If FLOOR > j, set STATE ← GOINGDOWN; if FLOOR < j, set
+	// D4. [Set STATE.] If FLOOR > j, set STATE ← GOINGDOWN; if FLOOR < j, set
 	// STATE ← GOINGUP.
 	if s.ele.floor > j {
 		s.ele.state = stateGoingDown
+		s.explain("D4", "FLOOR %d > j = %d, STATE ← GOINGDOWN.", s.ele.floor, j)
 	} else if s.ele.floor < j {
 		s.ele.state = stateGoingUp
+		s.explain("D4", "FLOOR %d < j = %d, STATE ← GOINGUP.", s.ele.floor, j)
+	} else {
+		s.explain("D4", "FLOOR = j = %d, STATE stays NEUTRAL.", j)
 	}
 
 	// D5. [Elevator dormant?] If the elevator coroutine is positioned at step E1, and
 	// if j ̸= 2, set the elevator to perform step E6 after 20 units of time. Exit
 	// from the subroutine.
-	if s.ele.step == stepWaitForCall && j != 2 {
-		s.scheduleElevator(&s.ele.elev1, 20, newWaitFunc(s.executePrepareToMove))
+	if s.ele.step == stepWaitForCall && j != home {
+		s.explain("D5", "Dormant and j ≠ %d, E6 in %d.", home, s.cfg.timing.decide)
+		s.cover[branchWakeUp]++
+		s.sendElevator(s.cfg.timing.decide, stepPrepareToMove)
 		return
 	}
 }
 
 func (s *simulator) print(step, action string, a ...interface{}) {
-	var state, d1, d2, d3 rune
-	switch s.ele.state {
-	case stateGoingDown:
-		state = 'D'
-	case stateGoingUp:
-		state = 'U'
-	default:
-		state = 'N'
-	}
-	if s.ele.d1 {
-		d1 = 'X'
-	} else {
-		d1 = '0'
+	s.emit(s.newEvent(step, action, a))
+}
+
+// printUser prints a step that concerns user u; milestone tells what it means for u.
+func (s *simulator) printUser(u *user, milestone int, step, action string, a ...interface{}) {
+	e := s.newEvent(step, action, a)
+	e.user = u
+	e.milestone = milestone
+	s.emit(e)
+}
+
+// explain records which rule fired in a step, if the run is to explain itself.
+func (s *simulator) explain(step, action string, a ...interface{}) {
+	if !s.cfg.explain {
+		return
 	}
-	if s.ele.d2 {
-		d2 = 'X'
-	} else {
-		d2 = '0'
+	e := s.newEvent(step, action, a)
+	e.explanation = true
+	s.emit(e)
+}
+
+func (s *simulator) newEvent(step, action string, a []interface{}) *event {
+	return &event{
+		time:   s.time,
+		state:  s.ele.state,
+		floor:  s.ele.floor,
+		d1:     s.ele.doors.d1(),
+		d2:     s.ele.d2,
+		d3:     s.ele.doors.d3(),
+		step:   step,
+		action: fmt.Sprintf(action, a...),
 	}
-	if s.ele.d3 {
-		d3 = 'X'
-	} else {
-		d3 = '0'
+}
+
+func (s *simulator) emit(e *event) {
+	for _, o := range s.observers {
+		o.observe(s, e)
 	}
-	action = fmt.Sprintf(action, a...)
-	fmt.Printf("%04d\t%c\t%d\t%c\t%c\t%c\t%s\t%s\n", s.time, state, s.ele.floor, d1, d2, d3, step, action)
 }
 
 // The heart of the simulation control: It decides which activity is to act
 // next (namely, the first element of the WAIT list, which we know is nonempty),
-// and jumps to it.
-func main() {
-	fmt.Println("TIME\tSTATE\tFLOOR\tD1\tD2\tD3\tstep\taction")
-	s := newSimulator()
-	s.userEnterPrepareForSuccessor()
-	for {
+// and jumps to it. Only a scripted run, once its users are all gone, may find
+// the WAIT list empty without an error.
+func (s *simulator) run() error {
+	defer s.stopProcesses()
+	defer func() { s.settleDoors(min(s.time, s.cfg.duration)) }()
+	if s.cfg.engine == engineProcesses {
+		s.startElevator()
+	}
+	first := 0
+	if len(s.script) > 0 {
+		first = s.script[0].time
+	}
+	if s.script == nil || len(s.script) > 0 {
+		s.wait.sortIn(newWaitElement(first, newWaitFunc(s.userEnterPrepareForSuccessor)))
+	}
+	for !s.stopped {
 		n := s.wait.rlink
 		if n == s.wait {
-			fmt.Println("ERROR: Wait queue is empty.")
-			break
+			if s.script != nil && len(s.script) == 0 {
+				return nil
+			}
+			return errWaitEmpty
 		}
 		n.delete()
 		w := n.info.(*waitElement)
+		if s.sampler != nil {
+			s.sampler.advance(s, min(w.nextTime, s.cfg.duration))
+		}
 		s.time = w.nextTime
-		if s.time >= maxTime {
+		if s.time >= s.cfg.duration {
 			break
 		}
 		w.nextInst.execute()
+		if s.err != nil {
+			return s.err
+		}
+	}
+	return nil
+}
+
+var errWaitEmpty = errors.New("wait queue is empty")
+
+// registerFlags binds the command-line options shared by every command to c.
+func (c *config) registerFlags(fs *flag.FlagSet) {
+	fs.Int64Var(&c.seed, "seed", c.seed, "seed of the random number generator (0 means the clock)")
+	fs.IntVar(&c.floors, "floors", c.floors, "number of floors in the building")
+	fs.IntVar(&c.home, "home", c.home, "the home floor, where the elevator waits when dormant")
+	fs.IntVar(&c.interMin, "intermin", c.interMin, "shortest time between arrivals, in tenths of a second")
+	fs.IntVar(&c.interMax, "intermax", c.interMax, "longest time between arrivals, in tenths of a second")
+	fs.IntVar(&c.duration, "duration", c.duration, "length of the simulation, in tenths of a second")
+	c.timing.registerFlags(fs)
+	fs.IntVar(&c.capacity, "capacity", c.capacity, "maximum number of people on board the elevator (0 means unlimited)")
+	fs.BoolVar(&c.fullLoadBypass, "bypass", c.fullLoadBypass, "a full elevator does not stop for hall calls")
+	fs.StringVar(&c.policy, "policy", c.policy, "policy that chooses the next floor in DECISION ("+strings.Join(policyNames(), ", ")+")")
+	fs.BoolVar(&c.explain, "explain", c.explain, "show which rule fired in DECISION, E2, E7, and E8")
+	fs.StringVar(&c.engine, "engine", c.engine, "how users and the elevator are run: callbacks or processes")
+	fs.IntVar(&c.balkLength, "balk", c.balkLength, "a user walks at once if this many people are already waiting (0 means never)")
+	fs.BoolVar(&c.stairsOneFloor, "stairs", c.stairsOneFloor, "users take the stairs for one-floor trips")
+	fs.Float64Var(&c.wrongWay, "wrongway", c.wrongWay, "probability that a user gets into an elevator going the other way")
+	fs.BoolVar(&c.repress, "repress", c.repress, "users left behind press the call button again")
+	fs.BoolVar(&c.cancelCalls, "cancel", c.cancelCalls, "turn off a hall call when the last user waiting for it gives up")
+	fs.StringVar(&c.boarding, "boarding", c.boarding, "who may get in: anyone (knuth) or only users going the elevator's way (direction)")
+	fs.IntVar(&c.walkUp, "walkup", c.walkUp, "time in tenths of a second to climb one floor by the stairs")
+	fs.IntVar(&c.walkDown, "walkdown", c.walkDown, "time in tenths of a second to descend one floor by the stairs")
+	fs.Func("groups", "comma-separated relative weights of groups of 1, 2, 3, ... users arriving together", func(value string) error {
+		sizes, err := parseGroupSizes(value)
+		c.groupSizes = sizes
+		return err
+	})
+	fs.Var(&c.classes, "classes", "comma-separated passenger classes NAME:WEIGHT:IN[:OUT] with their times to get in and out")
+	fs.Var(&c.buttons, "buttons", "comma-separated call buttons on each floor from the bottom: U, D, UD, or - for none (default both everywhere); random trips that need a missing button are drawn again")
+}
+
+func (t *timing) registerFlags(fs *flag.FlagSet) {
+	fs.IntVar(&t.quickClose, "quickclose", t.quickClose, "U5: time until the doors close when a destination is chosen in NEUTRAL")
+	fs.IntVar(&t.openDoors, "open", t.openDoors, "E3: time to open the doors")
+	fs.IntVar(&t.autoClose, "autoclose", t.autoClose, "E3: time until the doors try to close by themselves")
+	fs.IntVar(&t.inaction, "inaction", t.inaction, "E3: time until the inaction indicator is set")
+	fs.IntVar(&t.transfer, "transfer", t.transfer, "E4: time for one person to get out or in")
+	fs.IntVar(&t.flutter, "flutter", t.flutter, "E5: time the doors spring open while someone is getting out or in")
+	fs.IntVar(&t.closeDoors, "close", t.closeDoors, "E5: time to close the doors")
+	fs.IntVar(&t.accelerate, "accelerate", t.accelerate, "E6: time to build up speed")
+	fs.IntVar(&t.upFloor, "upfloor", t.upFloor, "E7: time to go up one floor")
+	fs.IntVar(&t.upStop, "upstop", t.upStop, "E7: time to decelerate after going up")
+	fs.IntVar(&t.downFloor, "downfloor", t.downFloor, "E8: time to go down one floor")
+	fs.IntVar(&t.downStop, "downstop", t.downStop, "E8: time to decelerate after going down")
+	fs.IntVar(&t.decide, "decide", t.decide, "D2 and D5: time until the dormant elevator starts to act")
+}
+
+func (c *config) validate() error {
+	if _, ok := policies[c.policy]; !ok {
+		return fmt.Errorf("unknown policy %q", c.policy)
+	}
+	if c.boarding != boardingKnuth && c.boarding != boardingDirection {
+		return fmt.Errorf("unknown boarding rule %q", c.boarding)
+	}
+	if c.engine != engineCallbacks && c.engine != engineProcesses {
+		return fmt.Errorf("unknown engine %q", c.engine)
+	}
+	if c.floors < 2 {
+		return fmt.Errorf("there must be at least 2 floors")
+	}
+	if c.home < 0 || c.home >= c.floors {
+		return fmt.Errorf("home floor %d is not in the building", c.home)
+	}
+	if c.interMin < 0 || c.interMax <= c.interMin {
+		return fmt.Errorf("intermax must be greater than intermin")
+	}
+	if c.duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if err := c.timing.validate(); err != nil {
+		return err
+	}
+	if c.capacity < 0 {
+		return fmt.Errorf("capacity must not be negative")
+	}
+	if c.balkLength < 0 {
+		return fmt.Errorf("balk must not be negative")
+	}
+	if c.wrongWay < 0 || c.wrongWay > 1 {
+		return fmt.Errorf("wrongway %g is not a probability", c.wrongWay)
+	}
+	if c.walkUp < 0 || c.walkDown < 0 {
+		return fmt.Errorf("walkup and walkdown must not be negative")
+	}
+	return c.buttons.validate(c.floors)
+}
+
+// validate rejects a timing profile in which an action takes no time, or less:
+// the clock would stand still or run backwards in the WAIT list.
+func (t timing) validate() error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	t.registerFlags(fs)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err == nil && f.Value.(flag.Getter).Get().(int) <= 0 {
+			err = fmt.Errorf("%s must be positive", f.Name)
+		}
+	})
+	return err
+}
+
+// parseFlags parses the options of the named command, including the shared ones.
+func parseFlags(fs *flag.FlagSet, cfg *config, args []string) error {
+	cfg.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return cfg.validate()
+}
+
+// The run command prints the trace of a single simulation followed by its statistics.
+func runCommand(args []string) error {
+	cfg := newConfig()
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	svgFile := fs.String("svg", "", "write a space-time diagram of the run to this SVG file")
+	pngFile := fs.String("png", "", "write a space-time diagram of the run to this PNG file")
+	journeysFile := fs.String("journeys", "", "write every user's journey to this CSV file (JSON if the name ends in .json)")
+	seriesFile := fs.String("series", "", "write time-series samples to this CSV file")
+	metricsFile := fs.String("metrics", "", "write time-series samples to this file in the OpenMetrics text format")
+	interval := fs.Int("interval", 100, "time between time-series samples, in tenths of a second")
+	if err := parseFlags(fs, cfg, args); err != nil {
+		return err
+	}
+	s := newSimulator(cfg)
+	s.observers = append(s.observers, newTracePrinter(os.Stdout))
+	d := newDiagram()
+	if *svgFile != "" || *pngFile != "" {
+		s.observers = append(s.observers, d)
+	}
+	if *seriesFile != "" || *metricsFile != "" {
+		if *interval <= 0 {
+			return fmt.Errorf("interval must be positive")
+		}
+		s.sampler = newSampler(*interval)
+	}
+	if err := s.run(); err == errWaitEmpty {
+		fmt.Println("ERROR: Wait queue is empty.")
+	} else if err != nil {
+		return err
+	}
+	s.stats.report(os.Stdout)
+	s.cover.report(os.Stdout)
+	if *svgFile != "" {
+		if err := writeFile(*svgFile, d.writeSVG); err != nil {
+			return err
+		}
+	}
+	if *pngFile != "" {
+		if err := writeFile(*pngFile, d.writePNG); err != nil {
+			return err
+		}
+	}
+	if *journeysFile != "" {
+		write := s.writeJourneysCSV
+		if strings.HasSuffix(*journeysFile, ".json") {
+			write = s.writeJourneysJSON
+		}
+		if err := writeFile(*journeysFile, write); err != nil {
+			return err
+		}
+	}
+	if *seriesFile != "" {
+		if err := writeFile(*seriesFile, s.sampler.writeCSV); err != nil {
+			return err
+		}
+	}
+	if *metricsFile != "" {
+		if err := writeFile(*metricsFile, s.sampler.writeMetrics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var commands = map[string]func(args []string) error{
+	"run":       runCommand,
+	"tui":       tuiCommand,
+	"serve":     serveCommand,
+	"replicate": replicateCommand,
+	"sweep":     sweepCommand,
+	"scenario":  scenarioCommand,
+	"explore":   exploreCommand,
+}
+
+func main() {
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		os.Exit(2)
+	}
+	if err := command(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,766 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// calls lists lit buttons by floor.
+type calls struct {
+	up, down, car []int
+}
+
+func (c calls) press(e *elevator) {
+	for _, j := range c.up {
+		e.callUp[j] = true
+	}
+	for _, j := range c.down {
+		e.callDown[j] = true
+	}
+	for _, j := range c.car {
+		e.callCar[j] = true
+	}
+}
+
+func lit(e *elevator) calls {
+	var c calls
+	for j := range e.callUp {
+		if e.callUp[j] {
+			c.up = append(c.up, j)
+		}
+		if e.callDown[j] {
+			c.down = append(c.down, j)
+		}
+		if e.callCar[j] {
+			c.car = append(c.car, j)
+		}
+	}
+	return c
+}
+
+// newTestSimulator is a simulator with the default configuration at time 1000,
+// so that scheduled times are easy to tell from zero.
+func newTestSimulator() *simulator {
+	cfg := newConfig()
+	cfg.seed = 1
+	s := newSimulator(cfg)
+	s.time = 1000
+	return s
+}
+
+// due returns how long from now the action in an elevator slot will happen, or
+// -1 if nothing is scheduled there.
+func due(s *simulator, n *node) int {
+	if n == nil || n.llink == n {
+		return -1
+	}
+	return n.info.(*waitElement).nextTime - s.time
+}
+
+// queueUser puts a new user in the queue of floor in, as step U3 does.
+func queueUser(s *simulator, id, in, out int) *user {
+	u := newUser(id, in, out, 500)
+	u.arrival = s.time
+	s.userEnterQueue(u)
+	return u
+}
+
+// boardUser puts a new user on the elevator, as step U5 does.
+func boardUser(s *simulator, id, in, out int) *user {
+	u := newUser(id, in, out, 500)
+	u.listNode = newNode(u)
+	s.ele.stack.insertLeft(u.listNode)
+	s.ele.load++
+	return u
+}
+
+// runNow executes the actions on the WAIT list that are due at the current time.
+func runNow(s *simulator) {
+	for n := s.wait.rlink; n != s.wait && n.info.(*waitElement).nextTime == s.time; n = s.wait.rlink {
+		n.delete()
+		n.info.(*waitElement).nextInst.execute()
+	}
+}
+
+func TestDecision(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		step      int
+		state     int
+		floor     int
+		calls     calls
+		wantState int
+		wantElev1 int
+	}{
+		{"not neutral", "knuth", stepWaitForCall, stateGoingUp, 2, calls{up: []int{0}}, stateGoingUp, -1},
+		{"dormant with call at home", "knuth", stepWaitForCall, stateNeutral, 2, calls{down: []int{2}}, stateNeutral, 20},
+		{"dormant with call above", "knuth", stepWaitForCall, stateNeutral, 2, calls{down: []int{4}}, stateGoingUp, 20},
+		{"dormant with call below", "knuth", stepWaitForCall, stateNeutral, 2, calls{up: []int{0}}, stateGoingDown, 20},
+		{"no calls from E6", "knuth", stepPrepareToMove, stateNeutral, 4, calls{}, stateGoingDown, -1},
+		{"no calls from E6 at home", "knuth", stepPrepareToMove, stateNeutral, 2, calls{}, stateNeutral, -1},
+		{"no calls from E9", "knuth", stepLetPeopleOutIn, stateNeutral, 4, calls{}, stateNeutral, -1},
+		{"call on this floor only", "knuth", stepPrepareToMove, stateNeutral, 4, calls{up: []int{4}}, stateGoingDown, -1},
+		{"smallest call first", "knuth", stepPrepareToMove, stateNeutral, 2, calls{up: []int{0}, car: []int{3}}, stateGoingDown, -1},
+		{"nearest call first", "nearest", stepPrepareToMove, stateNeutral, 2, calls{up: []int{0}, car: []int{3}}, stateGoingUp, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.policy = policies[tt.policy]
+			s.ele.step, s.ele.state, s.ele.floor = tt.step, tt.state, tt.floor
+			tt.calls.press(s.ele)
+			s.decision()
+			if s.ele.state != tt.wantState {
+				t.Errorf("STATE = %c, want %c", stateRune(s.ele.state), stateRune(tt.wantState))
+			}
+			if got := due(s, s.ele.elev1); got != tt.wantElev1 {
+				t.Errorf("elevator acts in %d, want %d", got, tt.wantElev1)
+			}
+		})
+	}
+}
+
+func TestUserEnter(t *testing.T) {
+	s := newTestSimulator()
+	s.script = []arrival{{time: 1000, in: 3, out: 1, giveUpTime: 400}, {time: 1234, in: 0, out: 4, giveUpTime: 300}}
+	s.userEnterPrepareForSuccessor()
+	runNow(s)
+	if len(s.users) != 1 {
+		t.Fatalf("%d users entered, want 1", len(s.users))
+	}
+	u := s.users[0]
+	if u.in != 3 || u.out != 1 || u.giveUpTime != 400 || u.direction != stateGoingDown {
+		t.Errorf("user is IN %d OUT %d GIVEUPTIME %d, want 3, 1, 400", u.in, u.out, u.giveUpTime)
+	}
+	var times []int
+	for p := s.wait.rlink; p != s.wait; p = p.rlink {
+		times = append(times, p.info.(*waitElement).nextTime)
+	}
+	if want := []int{1020, 1234, 1400}; !reflect.DeepEqual(times, want) {
+		t.Errorf("WAIT list times %v, want %v (the elevator waking, the next user, and giving up)", times, want)
+	}
+	if s.ele.queue[3].length() != 1 || !s.ele.callDown[3] {
+		t.Errorf("user is not waiting for the elevator going down")
+	}
+}
+
+func TestUserSignalAndWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       func(c *config)
+		step      int
+		floor     int
+		doors     doors
+		queued    int
+		in, out   int
+		wantCalls calls
+		wantElev1 int
+		wantD1    bool
+		wantWalk  bool
+	}{
+		{"doors closing", nil, stepCloseDoors, 2, doorsClosing, 0, 2, 4, calls{}, 0, false, false},
+		{"doors open", nil, stepLetPeopleOutIn, 2, doorsOpenIdle, 0, 2, 4, calls{}, 0, true, false},
+		{"presses up", nil, stepGoUpAFloor, 1, doorsClosed, 0, 2, 4, calls{up: []int{2}}, -1, false, false},
+		{"presses down", nil, stepGoUpAFloor, 1, doorsClosed, 0, 2, 0, calls{down: []int{2}}, -1, false, false},
+		{"wakes the dormant elevator", nil, stepWaitForCall, 2, doorsClosed, 0, 4, 0, calls{down: []int{4}}, 20, false, false},
+		{"takes the stairs", func(c *config) { c.stairsOneFloor = true }, stepWaitForCall, 2, doorsClosed, 0, 3, 4, calls{}, -1, false, true},
+		{"balks", func(c *config) { c.balkLength = 2 }, stepGoUpAFloor, 0, doorsClosed, 2, 3, 4, calls{}, -1, false, true},
+		{"short queue", func(c *config) { c.balkLength = 2 }, stepGoUpAFloor, 0, doorsClosed, 1, 3, 4, calls{up: []int{3}}, -1, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			if tt.cfg != nil {
+				tt.cfg(s.cfg)
+			}
+			for i := 0; i < tt.queued; i++ {
+				queueUser(s, 10+i, tt.in, tt.out)
+			}
+			s.ele.step, s.ele.floor, s.ele.doors, s.ele.d2 = tt.step, tt.floor, tt.doors, true
+			u := newUser(1, tt.in, tt.out, 500)
+			s.userSignalAndWait(u)
+			if got := lit(s.ele); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("buttons %+v, want %+v", got, tt.wantCalls)
+			}
+			if got := due(s, s.ele.elev1); got != tt.wantElev1 {
+				t.Errorf("elevator acts in %d, want %d", got, tt.wantElev1)
+			}
+			if s.ele.doors.d1() != tt.wantD1 {
+				t.Errorf("D1 = %v, want %v", s.ele.doors.d1(), tt.wantD1)
+			}
+			if walked := u.outcome != ""; walked != tt.wantWalk {
+				t.Errorf("walked = %v, want %v", walked, tt.wantWalk)
+			}
+		})
+	}
+}
+
+func TestUserEnterQueue(t *testing.T) {
+	s := newTestSimulator()
+	a := queueUser(s, 1, 3, 0)
+	b := queueUser(s, 2, 3, 4)
+	if got := userIDList(s.ele.queue[3]); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("QUEUE[3] = %v, want [1 2]", got)
+	}
+	for _, u := range []*user{a, b} {
+		if got := due(s, u.giveUp); got != 500 {
+			t.Errorf("user %d gives up in %d, want 500", u.id, got)
+		}
+	}
+}
+
+func TestUserGiveUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		floor    int
+		d1       bool
+		wantStay bool
+	}{
+		{"elevator elsewhere", 0, true, false},
+		{"doors closed", 3, false, false},
+		{"people moving on this floor", 3, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			u := queueUser(s, 1, 3, 0)
+			s.ele.floor = tt.floor
+			if tt.d1 {
+				s.ele.doors = doorsOpenBoarding
+			}
+			s.userGiveUp(u)
+			stayed := s.ele.queue[3].length() == 1
+			if stayed != tt.wantStay {
+				t.Errorf("stayed = %v, want %v", stayed, tt.wantStay)
+			}
+			if wantGaveUp := map[bool]int{true: 0, false: 1}[tt.wantStay]; s.stats.gaveUp != wantGaveUp {
+				t.Errorf("gave up %d, want %d", s.stats.gaveUp, wantGaveUp)
+			}
+		})
+	}
+}
+
+func TestCancelOrphanedCall(t *testing.T) {
+	tests := []struct {
+		name       string
+		cancel     bool
+		othersOut  []int
+		wantCallUp bool
+	}{
+		{"knuth", false, nil, true},
+		{"last user going up", true, []int{0}, false},
+		{"another user going up", true, []int{4}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.cfg.cancelCalls = tt.cancel
+			u := queueUser(s, 1, 3, 4)
+			for i, out := range tt.othersOut {
+				queueUser(s, 2+i, 3, out)
+			}
+			s.ele.callUp[3], s.ele.callDown[3] = true, true
+			s.userGiveUp(u)
+			if s.ele.callUp[3] != tt.wantCallUp {
+				t.Errorf("CALLUP[3] = %v, want %v", s.ele.callUp[3], tt.wantCallUp)
+			}
+			if !s.ele.callDown[3] {
+				t.Error("CALLDOWN[3] turned off")
+			}
+		})
+	}
+}
+
+// Under Knuth's rules the elevator stops for the call of a user who has given
+// up; with -cancel it does not.
+func TestPhantomStops(t *testing.T) {
+	for _, cancel := range []bool{false, true} {
+		cfg := newConfig()
+		cfg.cancelCalls = cancel
+		s := newSimulator(cfg)
+		s.script = []arrival{{time: 0, in: 4, out: 0, giveUpTime: 20}}
+		if err := s.run(); err != nil {
+			t.Fatal(err)
+		}
+		want := map[bool]int{false: 1, true: 0}[cancel]
+		if s.stats.phantomStops != want {
+			t.Errorf("cancel %v: %d phantom stops, want %d", cancel, s.stats.phantomStops, want)
+		}
+		if s.ele.floor != cfg.home {
+			t.Errorf("cancel %v: the elevator ended on floor %d, want %d", cancel, s.ele.floor, cfg.home)
+		}
+	}
+}
+
+// With -cancel the elevator stops short only for a call it was heading for
+// that was turned off, not on its way home with nothing ahead.
+func TestCancelStops(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel bool
+		script []arrival
+		want   []int
+	}{
+		{"going home", false, []arrival{{time: 0, in: 2, out: 4, giveUpTime: 1000}}, []int{4, 2}},
+		{"going home, cancel", true, []arrival{{time: 0, in: 2, out: 4, giveUpTime: 1000}}, []int{4, 2}},
+		{"call given up", false, []arrival{{time: 0, in: 4, out: 0, giveUpTime: 20}}, []int{4, 2}},
+		{"call given up, cancel", true, []arrival{{time: 0, in: 4, out: 0, giveUpTime: 20}}, []int{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig()
+			cfg.cancelCalls = tt.cancel
+			s := newSimulator(cfg)
+			s.script = tt.script
+			var stops []int
+			s.observers = append(s.observers, observerFunc(func(s *simulator, e *event) {
+				if e.step == "E2" {
+					stops = append(stops, s.ele.floor)
+				}
+			}))
+			if err := s.run(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stops, tt.want) {
+				t.Errorf("stopped at floors %v, want %v", stops, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserGetIn(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     int
+		out       int
+		wantState int
+		wantElev2 int
+		wrongWay  int
+	}{
+		{"neutral going up", stateNeutral, 4, stateGoingUp, 25, 0},
+		{"neutral going down", stateNeutral, 0, stateGoingDown, 25, 0},
+		{"same direction", stateGoingUp, 4, stateGoingUp, -1, 0},
+		{"wrong way", stateGoingUp, 0, stateGoingUp, -1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			u := queueUser(s, 1, 2, tt.out)
+			s.time += 100
+			s.ele.state = tt.state
+			s.userGetIn(u)
+			if s.ele.state != tt.wantState {
+				t.Errorf("STATE = %c, want %c", stateRune(s.ele.state), stateRune(tt.wantState))
+			}
+			if got := due(s, s.ele.elev2); got != tt.wantElev2 {
+				t.Errorf("doors close in %d, want %d", got, tt.wantElev2)
+			}
+			if !s.ele.callCar[tt.out] || s.ele.load != 1 || s.ele.queue[2].length() != 0 {
+				t.Errorf("user did not move from the queue into the elevator")
+			}
+			if due(s, u.giveUp) != -1 {
+				t.Errorf("giving up was not canceled")
+			}
+			if s.stats.waitTime != 100 || s.stats.wrongWayBoardings != tt.wrongWay {
+				t.Errorf("wait time %d, wrong-way boardings %d, want 100, %d", s.stats.waitTime, s.stats.wrongWayBoardings, tt.wrongWay)
+			}
+		})
+	}
+}
+
+func TestUserGetOut(t *testing.T) {
+	s := newTestSimulator()
+	u := boardUser(s, 1, 2, 4)
+	s.userGetOut(u)
+	if s.ele.load != 0 || s.ele.stack.length() != 0 || s.stats.delivered != 1 || u.outcome != outcomeDelivered {
+		t.Errorf("user was not delivered")
+	}
+}
+
+func TestChangeOfState(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     int
+		floor     int
+		calls     calls
+		wantState int
+		wantCalls calls
+	}{
+		{"up with calls above", stateGoingUp, 2, calls{up: []int{2}, car: []int{4}}, stateGoingUp, calls{up: []int{2}, car: []int{4}}},
+		{"up to neutral", stateGoingUp, 4, calls{down: []int{4}, car: []int{4}}, stateNeutral, calls{}},
+		{"up turns down", stateGoingUp, 4, calls{down: []int{4}, up: []int{1}}, stateGoingDown, calls{up: []int{1}}},
+		{"down with calls below", stateGoingDown, 2, calls{car: []int{0}}, stateGoingDown, calls{car: []int{0}}},
+		{"down to neutral", stateGoingDown, 0, calls{up: []int{0}}, stateNeutral, calls{}},
+		{"down turns up", stateGoingDown, 1, calls{car: []int{1, 3}}, stateGoingUp, calls{car: []int{3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.ele.state, s.ele.floor = tt.state, tt.floor
+			tt.calls.press(s.ele)
+			s.executeChangeOfState()
+			if s.ele.state != tt.wantState {
+				t.Errorf("STATE = %c, want %c", stateRune(s.ele.state), stateRune(tt.wantState))
+			}
+			if got := lit(s.ele); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("buttons %+v, want %+v", got, tt.wantCalls)
+			}
+			if got := due(s, s.ele.elev1); got != 0 {
+				t.Errorf("doors open in %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestOpenDoors(t *testing.T) {
+	s := newTestSimulator()
+	s.executeOpenDoors()
+	if s.ele.doors != doorsOpening || !s.ele.doors.d1() || !s.ele.d2 {
+		t.Errorf("doors %s, D2 = %v, want opening and D1 and D2 set", s.ele.doors, s.ele.d2)
+	}
+	for _, x := range []struct {
+		name string
+		slot *node
+		want int
+	}{
+		{"E4", s.ele.elev1, 20},
+		{"E5", s.ele.elev2, 76},
+		{"E9", s.ele.elev3, 300},
+	} {
+		if got := due(s, x.slot); got != x.want {
+			t.Errorf("%s in %d, want %d", x.name, got, x.want)
+		}
+	}
+}
+
+func TestLetPeopleOutIn(t *testing.T) {
+	tests := []struct {
+		name      string
+		capacity  int
+		state     int
+		wrongWay  bool
+		riders    []int // OUT of each user on board
+		queue     []int // OUT of each user waiting on floor 2
+		wantOut   []int // users sent to U6
+		wantIn    []int // users sent to U5
+		wantElev1 int
+		wantD3    bool
+	}{
+		{"nobody", 0, stateGoingUp, true, nil, nil, nil, nil, -1, true},
+		{"out before in", 0, stateGoingUp, true, []int{2, 4}, []int{3}, []int{1}, nil, 25, false},
+		{"last in, first out", 0, stateGoingUp, true, []int{2, 2}, nil, []int{2}, nil, 25, false},
+		{"front of queue in", 0, stateGoingUp, true, nil, []int{4, 3}, nil, []int{1}, 25, false},
+		{"full", 1, stateGoingUp, true, []int{4}, []int{3}, nil, nil, -1, true},
+		{"refuses the wrong way", 0, stateGoingUp, false, nil, []int{0, 3}, nil, []int{2}, 25, false},
+		{"everyone refuses", 0, stateGoingDown, false, nil, []int{3}, nil, nil, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.cfg.capacity = tt.capacity
+			s.ele.state, s.ele.doors = tt.state, doorsOpening
+			id := 0
+			for _, out := range tt.riders {
+				id++
+				boardUser(s, id, 0, out)
+			}
+			for _, out := range tt.queue {
+				id++
+				queueUser(s, id, 2, out).wrongWay = tt.wrongWay
+			}
+			var gotOut, gotIn []int
+			s.observers = append(s.observers, observerFunc(func(s *simulator, e *event) {
+				switch e.step {
+				case "U5":
+					gotIn = append(gotIn, e.user.id-len(tt.riders))
+				case "U6":
+					gotOut = append(gotOut, e.user.id)
+				}
+			}))
+			s.executeLetPeopleOutIn()
+			runNow(s)
+			if !reflect.DeepEqual(gotOut, tt.wantOut) || !reflect.DeepEqual(gotIn, tt.wantIn) {
+				t.Errorf("out %v, in %v, want %v, %v", gotOut, gotIn, tt.wantOut, tt.wantIn)
+			}
+			if got := due(s, s.ele.elev1); got != tt.wantElev1 {
+				t.Errorf("E4 repeats in %d, want %d", got, tt.wantElev1)
+			}
+			if s.ele.doors.d3() != tt.wantD3 || s.ele.doors.d1() == tt.wantD3 {
+				t.Errorf("doors %s, want D3 = %v", s.ele.doors, tt.wantD3)
+			}
+		})
+	}
+}
+
+// With the direction rule, the elevator lets in only users going its way, and
+// keeps the hall call of the others lit when it changes state.
+func TestDirectionBoarding(t *testing.T) {
+	s := newTestSimulator()
+	s.cfg.boarding = boardingDirection
+	s.ele.state, s.ele.doors = stateGoingUp, doorsOpening
+	queueUser(s, 1, 2, 0).wrongWay = true
+	queueUser(s, 2, 2, 4).wrongWay = true
+	var in []int
+	s.observers = append(s.observers, observerFunc(func(s *simulator, e *event) {
+		if e.step == "U5" {
+			in = append(in, e.user.id)
+		}
+	}))
+	s.executeLetPeopleOutIn()
+	runNow(s)
+	if !reflect.DeepEqual(in, []int{2}) {
+		t.Errorf("users %v got in, want [2]", in)
+	}
+
+	for _, rule := range []string{boardingKnuth, boardingDirection} {
+		s := newTestSimulator()
+		s.cfg.boarding = rule
+		s.ele.state, s.ele.floor = stateGoingDown, 1
+		calls{up: []int{1}, down: []int{1}, car: []int{1, 3}}.press(s.ele)
+		s.executeChangeOfState()
+		want, wantState := calls{car: []int{3}}, stateGoingUp
+		if rule == boardingDirection {
+			// stopped for CALLDOWN[1]: the users going down get in first
+			want.up, wantState = []int{1}, stateGoingDown
+		}
+		if got := lit(s.ele); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: buttons %+v, want %+v", rule, got, want)
+		}
+		if s.ele.state != wantState {
+			t.Errorf("%s: STATE %s, want %s", rule, stateName(s.ele.state), stateName(wantState))
+		}
+	}
+}
+
+func TestWrongWayFloors(t *testing.T) {
+	s := newTestSimulator()
+	boardUser(s, 1, 2, 0)
+	boardUser(s, 2, 2, 4)
+	s.executeGoUpAFloor()
+	s.executeGoDownAFloor()
+	s.executeGoDownAFloor()
+	if s.stats.wrongWayFloors != 3 {
+		t.Errorf("wrong-way floors %d, want 3 (user 1 going up, user 2 going down twice)", s.stats.wrongWayFloors)
+	}
+}
+
+// observerFunc lets a function observe events.
+type observerFunc func(s *simulator, e *event)
+
+func (f observerFunc) observe(s *simulator, e *event) {
+	f(s, e)
+}
+
+func TestCloseDoors(t *testing.T) {
+	tests := []struct {
+		name      string
+		d1        bool
+		wantElev1 int
+		wantElev2 int
+	}{
+		{"people moving", true, -1, 40},
+		{"nobody moving", false, 20, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.ele.doors = doorsOpenIdle
+			if tt.d1 {
+				s.ele.doors = doorsOpenBoarding
+			}
+			s.executeCloseDoors()
+			if got := due(s, s.ele.elev1); got != tt.wantElev1 {
+				t.Errorf("E6 in %d, want %d", got, tt.wantElev1)
+			}
+			if got := due(s, s.ele.elev2); got != tt.wantElev2 {
+				t.Errorf("E5 repeats in %d, want %d", got, tt.wantElev2)
+			}
+			if !tt.d1 && s.ele.doors != doorsClosing {
+				t.Errorf("doors %s, want closing", s.ele.doors)
+			}
+		})
+	}
+}
+
+func TestPrepareToMove(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     int
+		floor     int
+		calls     calls
+		wantState int
+		wantCalls calls
+		wantStep  int // the step the elevator is sent to
+	}{
+		{"dormant", stateNeutral, 2, calls{car: []int{2}}, stateNeutral, calls{}, stepWaitForCall},
+		{"home from above", stateNeutral, 4, calls{}, stateGoingDown, calls{}, stepGoDownAFloor},
+		{"up keeps down call", stateGoingUp, 1, calls{up: []int{1}, down: []int{1}, car: []int{1, 3}}, stateGoingUp, calls{down: []int{1}, car: []int{3}}, stepGoUpAFloor},
+		{"down keeps up call", stateGoingDown, 3, calls{up: []int{3}, down: []int{3}, car: []int{0}}, stateGoingDown, calls{up: []int{3}, car: []int{0}}, stepGoDownAFloor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.ele.state, s.ele.floor, s.ele.d2 = tt.state, tt.floor, true
+			s.executeOpenDoors()
+			tt.calls.press(s.ele)
+			s.ele.elev1.delete()
+			s.ele.elev2.delete()
+			s.ele.doors = doorsClosing // as if E4 and E5 had run
+			s.executePrepareToMove()
+			if s.ele.state != tt.wantState {
+				t.Errorf("STATE = %c, want %c", stateRune(s.ele.state), stateRune(tt.wantState))
+			}
+			if got := lit(s.ele); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("buttons %+v, want %+v", got, tt.wantCalls)
+			}
+			wantE9 := 300
+			if tt.wantStep != stepWaitForCall {
+				wantE9 = -1
+				if got := due(s, s.ele.elev1); got != 15 {
+					t.Errorf("moves in %d, want 15", got)
+				}
+			}
+			if got := due(s, s.ele.elev3); got != wantE9 {
+				t.Errorf("E9 in %d, want %d", got, wantE9)
+			}
+			s.time += due(s, s.ele.elev1)
+			runNow(s)
+			if s.ele.step != tt.wantStep {
+				t.Errorf("elevator went to E%d, want E%d", s.ele.step, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestGoAFloor(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    int
+		floor    int
+		calls    calls
+		load     int
+		bypass   bool
+		wantStop bool
+		wantWhy  string
+	}{
+		{"up, car call", stateGoingUp, 0, calls{car: []int{1}}, 0, false, true, "Stop because CALLCAR[1]."},
+		{"up, up call", stateGoingUp, 0, calls{up: []int{1}, car: []int{3}}, 0, false, true, "Stop because CALLUP[1]."},
+		{"up, down call with calls above", stateGoingUp, 0, calls{down: []int{1}, car: []int{3}}, 0, false, false, "Pass floor 1: no call here."},
+		{"up, down call with nothing above", stateGoingUp, 0, calls{down: []int{1}}, 0, false, true, "Stop because CALLDOWN[1] and nothing above."},
+		{"up, home with nothing above", stateGoingUp, 1, calls{}, 0, false, true, "Stop at the home floor 2 with nothing above."},
+		{"up, passing home", stateGoingUp, 1, calls{car: []int{4}}, 0, false, false, "Pass floor 2: no call here."},
+		{"up, full, bypass", stateGoingUp, 0, calls{up: []int{1}, car: []int{3}}, 1, true, false, "Pass floor 1: full"},
+		{"up, full, bypass, car call", stateGoingUp, 0, calls{up: []int{1}, car: []int{1}}, 1, true, true, "Stop because CALLCAR[1]."},
+		{"up, full, bypass, last call", stateGoingUp, 0, calls{up: []int{1}}, 1, true, true, "Stop because CALLUP[1]."},
+		{"down, car call", stateGoingDown, 4, calls{car: []int{3}}, 0, false, true, "Stop because CALLCAR[3]."},
+		{"down, down call", stateGoingDown, 4, calls{down: []int{3}, car: []int{0}}, 0, false, true, "Stop because CALLDOWN[3]."},
+		{"down, up call with calls below", stateGoingDown, 4, calls{up: []int{3}, car: []int{0}}, 0, false, false, "Pass floor 3: no call here."},
+		{"down, home with nothing below", stateGoingDown, 3, calls{}, 0, false, true, "Stop at the home floor 2 with nothing below."},
+		{"down, full, bypass", stateGoingDown, 4, calls{down: []int{3}, car: []int{0}}, 1, true, false, "Pass floor 3: full"},
+		{"down, full, bypass, last call", stateGoingDown, 4, calls{down: []int{3}}, 1, true, true, "Stop because CALLDOWN[3]."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.cfg.capacity, s.cfg.fullLoadBypass, s.cfg.explain = 1, tt.bypass, true
+			s.ele.state, s.ele.floor, s.ele.load = tt.state, tt.floor, tt.load
+			var why string
+			s.observers = append(s.observers, observerFunc(func(s *simulator, e *event) {
+				if e.explanation {
+					why = e.action
+				}
+			}))
+			tt.calls.press(s.ele)
+			travel, stop := 51, 14
+			if tt.state == stateGoingUp {
+				s.executeGoUpAFloor()
+			} else {
+				travel, stop = 61, 23
+				s.executeGoDownAFloor()
+			}
+			if got := due(s, s.ele.elev1); got != travel {
+				t.Fatalf("next floor in %d, want %d", got, travel)
+			}
+			s.time += travel
+			s.ele.elev1.delete()
+			if tt.state == stateGoingUp {
+				s.executeGoUpAFloor2()
+			} else {
+				s.executeGoDownAFloor2()
+			}
+			want := 0
+			if tt.wantStop {
+				want = stop
+			}
+			if got := due(s, s.ele.elev1); got != want {
+				t.Errorf("next step in %d, want %d", got, want)
+			}
+			if !strings.HasPrefix(why, tt.wantWhy) {
+				t.Errorf("explained %q, want %q", why, tt.wantWhy)
+			}
+		})
+	}
+}
+
+func TestSetInactionIndicator(t *testing.T) {
+	tests := []struct {
+		name      string
+		floor     int
+		calls     calls
+		wantState int
+	}{
+		{"nothing to do", 2, calls{}, stateNeutral},
+		{"call below", 2, calls{up: []int{0}}, stateGoingDown},
+		{"call above", 2, calls{down: []int{3}}, stateGoingUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSimulator()
+			s.ele.floor, s.ele.d2, s.ele.step = tt.floor, true, stepLetPeopleOutIn
+			tt.calls.press(s.ele)
+			s.executeSetInactionIndicator()
+			if s.ele.d2 {
+				t.Errorf("D2 is still set")
+			}
+			if s.ele.state != tt.wantState {
+				t.Errorf("STATE = %c, want %c", stateRune(s.ele.state), stateRune(tt.wantState))
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{nil, ""},
+		{[]string{"-wrongway=0", "-walkup=0", "-capacity=0", "-balk=0"}, ""},
+		{[]string{"-transfer=-30"}, "transfer must be positive"},
+		{[]string{"-decide=-100"}, "decide must be positive"},
+		{[]string{"-upfloor=0"}, "upfloor must be positive"},
+		{[]string{"-duration=0"}, "duration must be positive"},
+		{[]string{"-capacity=-1"}, "capacity must not be negative"},
+		{[]string{"-balk=-1"}, "balk must not be negative"},
+		{[]string{"-wrongway=1.5"}, "wrongway 1.5 is not a probability"},
+		{[]string{"-wrongway=-0.1"}, "wrongway -0.1 is not a probability"},
+		{[]string{"-walkup=-1"}, "walkup and walkdown must not be negative"},
+		{[]string{"-walkdown=-1"}, "walkup and walkdown must not be negative"},
+	}
+	for _, tt := range tests {
+		cfg := newConfig()
+		if err := cfg.flagSet().Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		err := cfg.validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%v: %v", tt.args, err)
+			}
+		} else if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%v: error %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
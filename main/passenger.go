@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A passengerClass is a kind of user who takes a time of their own to get in
+// and out of the elevator in E4, such as someone with luggage, a cart, or a
+// wheelchair. Users of no class take the transfer time of the timing profile.
+type passengerClass struct {
+	name       string
+	weight     float64 // relative frequency among the random users
+	boardTime  int     // time to get in
+	alightTime int     // time to get out
+}
+
+// passengerClasses is the mix of users, written as the -classes option reads it:
+// a comma-separated list of NAME:WEIGHT:IN[:OUT], such as
+// "walking:90:25,luggage:8:40:35,wheelchair:2:80:70". Without OUT, getting out
+// takes as long as getting in.
+type passengerClasses []passengerClass
+
+func (c passengerClasses) String() string {
+	fields := make([]string, len(c))
+	for i, p := range c {
+		fields[i] = fmt.Sprintf("%s:%s:%d:%d", p.name, strconv.FormatFloat(p.weight, 'g', -1, 64), p.boardTime, p.alightTime)
+	}
+	return strings.Join(fields, ",")
+}
+
+func (c *passengerClasses) Set(value string) error {
+	var classes passengerClasses
+	total := 0.0
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) != 3 && len(parts) != 4 {
+			return fmt.Errorf("class %q: want NAME:WEIGHT:IN[:OUT]", field)
+		}
+		p := passengerClass{name: parts[0]}
+		if p.name == "" || classes.lookup(p.name) != nil {
+			return fmt.Errorf("class %q: the name must be given once", field)
+		}
+		w, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || w < 0 {
+			return fmt.Errorf("class %s: %q is not a weight", p.name, parts[1])
+		}
+		p.weight = w
+		total += w
+		times := []*int{&p.boardTime, &p.alightTime}
+		for i, part := range parts[2:] {
+			t, err := strconv.Atoi(part)
+			if err != nil || t <= 0 {
+				return fmt.Errorf("class %s: %q is not a positive time", p.name, part)
+			}
+			*times[i] = t
+		}
+		if len(parts) == 3 {
+			p.alightTime = p.boardTime
+		}
+		classes = append(classes, p)
+	}
+	if total <= 0 {
+		return fmt.Errorf("weights must not all be zero")
+	}
+	*c = classes
+	return nil
+}
+
+func (c passengerClasses) lookup(name string) *passengerClass {
+	for i := range c {
+		if c[i].name == name {
+			return &c[i]
+		}
+	}
+	return nil
+}
+
+// passengerClass draws the class of the next random user. Without a configured
+// mix no random number is consumed and the user has no class.
+func (s *simulator) passengerClass() *passengerClass {
+	classes := s.cfg.classes
+	if len(classes) == 0 {
+		return nil
+	}
+	total := 0.0
+	for _, p := range classes {
+		total += p.weight
+	}
+	r := s.random.passengers.Float64() * total
+	for i, p := range classes {
+		if r < p.weight {
+			return &classes[i]
+		}
+		r -= p.weight
+	}
+	return &classes[len(classes)-1]
+}
+
+// transferTime is how long E4 waits for a user to get in or out: t, the time of
+// the user's class, or the transfer time of the timing profile if t is zero.
+func (s *simulator) transferTime(t int) int {
+	if t > 0 {
+		return t
+	}
+	return s.cfg.timing.transfer
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPassengerClasses(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"walking:90:25,luggage:8:40:35", "walking:90:25:25,luggage:8:40:35", ""},
+		{"cart:0.5:60", "cart:0.5:60:60", ""},
+		{"cart:1", "", "want NAME:WEIGHT:IN[:OUT]"},
+		{"cart:1:60,cart:2:70", "", "the name must be given once"},
+		{":1:60", "", "the name must be given once"},
+		{"cart:-1:60", "", `"-1" is not a weight`},
+		{"cart:1:0", "", `"0" is not a positive time`},
+		{"cart:0:60", "", "weights must not all be zero"},
+	}
+	for _, tt := range tests {
+		var c passengerClasses
+		err := c.Set(tt.value)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.value, err)
+			} else if got := c.String(); got != tt.want {
+				t.Errorf("%s: written as %s, want %s", tt.value, got, tt.want)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want %q", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+// E4 waits as long as the user getting out or in takes.
+func TestClassTransferTime(t *testing.T) {
+	s := newTestSimulator()
+	s.ele.state, s.ele.doors = stateGoingUp, doorsOpening
+	rider := boardUser(s, 1, 0, 2)
+	rider.alightTime = 70
+	queueUser(s, 2, 2, 4).boardTime = 80
+	queueUser(s, 3, 2, 4)
+	for _, want := range []int{70, 80, 25} {
+		s.executeLetPeopleOutIn()
+		if got := due(s, s.ele.elev1); got != want {
+			t.Errorf("E4 again in %d, want %d", got, want)
+		}
+		n := s.wait.rlink // the user sent to U5 or U6
+		n.delete()
+		n.info.(*waitElement).nextInst.execute()
+		s.time += want
+	}
+	if s.stats.transfers != 3 || s.stats.transferTime != 175 {
+		t.Errorf("%d transfers in %d, want 3 in 175", s.stats.transfers, s.stats.transferTime)
+	}
+}
+
+// Drawing classes does not change who arrives when, where, and going where.
+func TestClassMix(t *testing.T) {
+	run := func(classes string) *simulator {
+		cfg := newConfig()
+		cfg.seed = 1
+		cfg.duration = 50000
+		if classes != "" {
+			if err := cfg.classes.Set(classes); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := newSimulator(cfg)
+		if err := s.run(); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	plain, mixed := run(""), run("walking:1:25,wheelchair:1:80:70")
+	if len(mixed.users) < 50 || len(mixed.users) != len(plain.users) {
+		t.Fatalf("%d users with classes, %d without", len(mixed.users), len(plain.users))
+	}
+	count := map[string]int{}
+	for i, u := range mixed.users {
+		p := plain.users[i]
+		if u.arrival != p.arrival || u.in != p.in || u.out != p.out || u.giveUpTime != p.giveUpTime {
+			t.Fatalf("user %d differs: %+v, without classes %+v", u.id, u.intent, p.intent)
+		}
+		count[u.class]++
+	}
+	if count["walking"] == 0 || count["wheelchair"] == 0 || count[""] != 0 {
+		t.Errorf("classes drawn %v", count)
+	}
+	if m := ratio(mixed.stats.transferTime, mixed.stats.transfers); m <= 25 || m >= 80 {
+		t.Errorf("mean transfer time %g, want between 25 and 80", m)
+	}
+}
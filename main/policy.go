@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sort"
+)
+
+// controlView is everything the controller is allowed to know when it decides
+// where the elevator goes next: the position and state of the car and which
+// buttons are lit. It deliberately holds no users. A waiting user reveals only
+// the direction of the hall button pressed in step U2, and a destination becomes
+// known only when CALLCAR[OUT] is pressed on boarding in step U5.
+type controlView struct {
+	floor    int
+	state    int
+	callUp   []bool
+	callDown []bool
+	callCar  []bool
+}
+
+// The view is a copy, so a policy cannot change the buttons behind the simulator's back.
+func (s *simulator) view() *controlView {
+	v := &controlView{
+		floor:    s.ele.floor,
+		state:    s.ele.state,
+		callUp:   make([]bool, len(s.ele.callUp)),
+		callDown: make([]bool, len(s.ele.callDown)),
+		callCar:  make([]bool, len(s.ele.callCar)),
+	}
+	copy(v.callUp, s.ele.callUp)
+	copy(v.callDown, s.ele.callDown)
+	copy(v.callCar, s.ele.callCar)
+	return v
+}
+
+func (v *controlView) isCalled(j int) bool {
+	return v.callUp[j] || v.callCar[j] || v.callDown[j]
+}
+
+// A policy selects the floor j in step D3 of the DECISION subroutine. It
+// returns false if there is no call to answer.
+type policy interface {
+	target(v *controlView) (int, bool)
+}
+
+// knuthPolicy is step D3 as written: the smallest j ≠ FLOOR with a call.
+type knuthPolicy struct{}
+
+func (knuthPolicy) target(v *controlView) (int, bool) {
+	for j := range v.callUp {
+		if j != v.floor && v.isCalled(j) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// nearestPolicy answers the call closest to FLOOR, preferring the lower floor on a tie.
+type nearestPolicy struct{}
+
+func (nearestPolicy) target(v *controlView) (int, bool) {
+	for d := 1; d < len(v.callUp); d++ {
+		if j := v.floor - d; j >= 0 && v.isCalled(j) {
+			return j, true
+		}
+		if j := v.floor + d; j < len(v.callUp) && v.isCalled(j) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+var policies = map[string]policy{
+	"knuth":   knuthPolicy{},
+	"nearest": nearestPolicy{},
+}
+
+func policyNames() []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,236 @@
+package main
+
+import "runtime"
+
+// The process engine is an alternative to the callbacks on the WAIT list. Each
+// user and the elevator run as goroutines, written as straight-line code that
+// holds for a while, passivates until another process activates it, and carries
+// on where it left off, the way Knuth's coroutines do.
+// Only one process runs at a time: the WAIT list still decides what happens next,
+// and resuming a process hands control to its goroutine until it holds or
+// passivates again. The two engines produce the same trace.
+const (
+	engineCallbacks = "callbacks"
+	engineProcesses = "processes"
+)
+
+type process struct {
+	resume chan interface{} // the value it is resumed with, nil when a hold is over
+	node   *node            // its pending activation on the WAIT list, if any
+}
+
+// interrupted is the value a process is resumed with when another process
+// activates it before its hold is over.
+type interrupted struct{}
+
+// An activation is a process's entry on the WAIT list.
+type activation struct {
+	s     *simulator
+	p     *process
+	value interface{}
+}
+
+// execute resumes the process and waits until it holds, passivates, or ends. A
+// panic in the process is raised again here, where the run can see it.
+func (a *activation) execute() {
+	a.p.node = nil
+	a.s.current = a.p
+	a.p.resume <- a.value
+	if r := <-a.s.yield; r != nil {
+		panic(r)
+	}
+}
+
+// newProcess starts a passive process. The body is given the value of its first
+// activation.
+func (s *simulator) newProcess(body func(start interface{})) *process {
+	if s.yield == nil {
+		s.yield = make(chan interface{})
+	}
+	p := &process{resume: make(chan interface{})}
+	s.processes = append(s.processes, p)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.yield <- r
+			}
+		}()
+		start, ok := <-p.resume
+		if !ok {
+			return
+		}
+		body(start)
+		s.yield <- nil
+	}()
+	return p
+}
+
+// spawn starts a process running body at once, ahead of everything else on
+// the WAIT list, as IMMED does for a callback.
+func (s *simulator) spawn(body func()) *process {
+	p := s.newProcess(func(interface{}) { body() })
+	p.node = s.wait.immed(newWaitElement(s.time, &activation{s, p, nil}))
+	return p
+}
+
+// suspend gives control back to the WAIT list until the current process is
+// resumed. When the run is over, the process ends instead.
+func (s *simulator) suspend() interface{} {
+	p := s.current
+	s.yield <- nil
+	v, ok := <-p.resume
+	if !ok {
+		runtime.Goexit()
+	}
+	return v
+}
+
+// hold lets d units of time pass for the current process. It returns nil if
+// they did pass, or the value another process activated it with first.
+func (s *simulator) hold(d int) interface{} {
+	p := s.current
+	p.node = s.wait.sortIn(newWaitElement(s.time+d, &activation{s, p, nil}))
+	return s.suspend()
+}
+
+// passivate suspends the current process until another one activates it, and
+// returns the value it is activated with.
+func (s *simulator) passivate() interface{} {
+	return s.suspend()
+}
+
+// activate resumes process p immediately with value, canceling its hold or
+// pending activation if it has one.
+func (s *simulator) activate(p *process, value interface{}) {
+	p.node.delete()
+	p.node = s.wait.immed(newWaitElement(s.time, &activation{s, p, value}))
+}
+
+// activateAfter resumes process p with value after d units of time, canceling
+// its hold or pending activation if it has one, and returns the WAIT list node.
+func (s *simulator) activateAfter(p *process, d int, value interface{}) *node {
+	p.node.delete()
+	p.node = s.wait.sortIn(newWaitElement(s.time+d, &activation{s, p, value}))
+	return p.node
+}
+
+// stopProcesses ends the goroutines of every process still waiting at the end
+// of a run.
+func (s *simulator) stopProcesses() {
+	for _, p := range s.processes {
+		close(p.resume)
+	}
+	s.processes = nil
+}
+
+// userProcess is the life of a user from step U2 on, for the process engine.
+// U1 starts it; E4 activates it to get in and again to get out.
+func (s *simulator) userProcess(u *user) {
+	if s.userSignalAndWait(u); u.outcome != "" {
+		return
+	}
+	s.userEnterQueue(u)
+	if s.hold(u.giveUpTime) == nil {
+		if s.userGiveUp(u); u.outcome != "" {
+			return
+		}
+		s.passivate()
+	}
+	s.userGetIn(u)
+	s.passivate()
+	s.userGetOut(u)
+}
+
+// startElevator starts a passive process for each activity of the elevator,
+// which waits dormant at E1 until DECISION sends it on.
+func (s *simulator) startElevator() {
+	s.elevator = s.newProcess(func(to interface{}) { s.elevatorProcess(to.(int)) })
+	s.closer = s.newProcess(func(interface{}) { s.closerProcess() })
+	s.inaction = s.newProcess(func(interface{}) { s.inactionProcess() })
+}
+
+// elevatorProcess is the elevator coroutine, activity ELEV1, for the process
+// engine. At a floor the elevator opens its doors and lets people out and in
+// until E5 sends it to E6; then it either goes dormant in E1 until DECISION
+// sends it on, or travels floor by floor to its next stop and stops there in E2.
+// The elevator coroutine is not entered at a single point, so other activities
+// send it to a step by activating it with that step: U2 to E3 or E4, DECISION
+// to E3 or E6, and E5 to E6. If that cuts a hold short, the elevator goes on at
+// the step it was sent to.
+func (s *simulator) elevatorProcess(to int) {
+	for {
+		for to != stepPrepareToMove {
+			if to == stepOpenDoors {
+				s.openDoors()
+				to = s.elevatorHold(s.cfg.timing.openDoors, stepLetPeopleOutIn)
+			} else if d := s.letPeopleOutIn(); d > 0 {
+				to = s.elevatorHold(d, stepLetPeopleOutIn)
+			} else {
+				to = s.passivate().(int) // until U2 or E5 sends the elevator on
+			}
+		}
+		s.prepareToMove()
+		if s.ele.state == stateNeutral {
+			s.executeWaitForCall()
+			to = s.passivate().(int)
+			continue
+		}
+		direction, move, travel, stop := s.ele.state, stepGoUpAFloor, s.cfg.timing.upFloor, s.cfg.timing.upStop
+		if direction == stateGoingDown {
+			move, travel, stop = stepGoDownAFloor, s.cfg.timing.downFloor, s.cfg.timing.downStop
+		}
+		to = s.elevatorHold(s.cfg.timing.accelerate, move)
+		for to == move {
+			s.goAFloor(direction)
+			if to = s.elevatorHold(travel, move); to == move && s.isStopCalled(direction) {
+				to = s.elevatorHold(stop, stepChangeOfState)
+			}
+		}
+		if to == stepChangeOfState {
+			s.changeOfState()
+			to = stepOpenDoors
+		}
+	}
+}
+
+// elevatorHold lets d units of time pass for the elevator and returns next, the
+// step that follows, or the step another activity sent the elevator to first.
+func (s *simulator) elevatorHold(d, next int) int {
+	if to := s.hold(d); to != nil {
+		return to.(int)
+	}
+	return next
+}
+
+// closerProcess is the independent activity E5. E3 and U5 set it to start, and
+// setting it again while it waits for the doors to stop fluttering only changes
+// when it takes the step again.
+func (s *simulator) closerProcess() {
+	for {
+		for s.closeDoors() {
+			s.hold(s.cfg.timing.flutter)
+		}
+		s.passivate()
+	}
+}
+
+// inactionProcess is the independent activity E9, which E3 sets to start and E6
+// cancels.
+func (s *simulator) inactionProcess() {
+	for {
+		s.executeSetInactionIndicator()
+		s.passivate()
+	}
+}
+
+// activity is the process of the independent activity E5 or E9 whose WAIT list
+// node is kept in elev, or nil with the callbacks.
+func (s *simulator) activity(elev **node) *process {
+	switch elev {
+	case &s.ele.elev2:
+		return s.closer
+	case &s.ele.elev3:
+		return s.inaction
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// engineTrace runs a configuration with the given engine and returns its trace
+// and statistics.
+func engineTrace(t *testing.T, cfg *config, script []arrival, engine string) string {
+	t.Helper()
+	c := *cfg
+	c.engine = engine
+	var b bytes.Buffer
+	s := newSimulator(&c)
+	if script != nil {
+		s.script = append([]arrival{}, script...)
+	}
+	s.observers = append(s.observers, newTracePrinter(&b))
+	if err := s.run(); err != nil {
+		t.Fatal(err)
+	}
+	s.stats.report(&b)
+	return b.String()
+}
+
+// sameTrace fails the test at the first line where the engines disagree.
+func sameTrace(t *testing.T, cfg *config, script []arrival) {
+	t.Helper()
+	want := strings.Split(engineTrace(t, cfg, script, engineCallbacks), "\n")
+	got := strings.Split(engineTrace(t, cfg, script, engineProcesses), "\n")
+	for i := 0; i < len(got) && i < len(want); i++ {
+		if got[i] != want[i] {
+			t.Fatalf("line %d:\n processes: %s\n callbacks: %s", i+1, got[i], want[i])
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("processes give %d lines, callbacks %d", len(got), len(want))
+	}
+}
+
+func TestProcessEngineScenarios(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.scenario"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			sc, err := loadScenario(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := newConfig()
+			if err := sc.configure(cfg); err != nil {
+				t.Fatal(err)
+			}
+			sameTrace(t, cfg, sc.script)
+		})
+	}
+}
+
+func TestProcessEngineRandom(t *testing.T) {
+	options := [][]string{
+		nil,
+		{"-capacity=2"},
+		{"-capacity=1", "-bypass"},
+		{"-capacity=3", "-repress=false", "-wrongway=0.5"},
+		{"-stairs", "-balk=3", "-policy=nearest"},
+		{"-boarding=direction", "-capacity=2", "-repress=false"},
+		{"-cancel", "-capacity=1", "-intermin=10", "-intermax=100"},
+		{"-classes=walking:6:25,luggage:3:40:35,wheelchair:1:80:70", "-capacity=3", "-groups=3,1"},
+		{"-groups=4,2,1", "-capacity=4"},
+		{"-floors=8", "-home=0", "-intermax=300"},
+		{"-inaction=100", "-autoclose=30", "-transfer=60"},
+	}
+	for _, args := range options {
+		for seed := int64(1); seed <= 5; seed++ {
+			cfg := newConfig()
+			if err := cfg.flagSet().Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			cfg.seed = seed
+			cfg.duration = 20000
+			t.Run(fmt.Sprint(args, seed), func(t *testing.T) {
+				sameTrace(t, cfg, nil)
+			})
+		}
+	}
+}
+
+// A run ends with users still waiting or on board; their goroutines must end too.
+func TestProcessEngineStops(t *testing.T) {
+	before := runtime.NumGoroutine()
+	cfg := newConfig()
+	cfg.seed = 1
+	cfg.engine = engineProcesses
+	s := newSimulator(cfg)
+	if err := s.run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.users) == 0 {
+		t.Fatal("nobody arrived")
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left running", n-before)
+	}
+}
+
+// A panic in a process reaches the caller of run.
+func TestProcessEnginePanic(t *testing.T) {
+	cfg := newConfig()
+	cfg.seed = 1
+	cfg.engine = engineProcesses
+	s := newSimulator(cfg)
+	s.observers = append(s.observers, observerFunc(func(s *simulator, e *event) {
+		if e.step == "U3" {
+			panic("boom")
+		}
+	}))
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want boom", r)
+		}
+	}()
+	s.run()
+	t.Error("run returned")
+}
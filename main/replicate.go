@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// deriveSeed gives replication i of a run with the given base seed (or random
+// number stream i of a simulator) a seed of its own, scrambled by the SplitMix64
+// finalizer so that neighboring replications do not get neighboring seeds.
+func deriveSeed(base int64, i int) int64 {
+	z := uint64(base) + uint64(i+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	if z == 0 {
+		z = 1
+	}
+	return int64(z >> 1)
+}
+
+// replicate runs k independent simulations of cfg, at most parallel at a time,
+// and returns the statistics and the coverage of each in order. Every simulator
+// has its own state, so the replications can run in separate goroutines. If a
+// replication fails, the error of the first one to fail is returned instead.
+func replicate(cfg *config, base int64, k, parallel int) ([][]statistic, []coverage, error) {
+	results := make([][]statistic, k)
+	covers := make([]coverage, k)
+	errs := make([]error, k)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				c := *cfg
+				c.seed = deriveSeed(base, i)
+				s := newSimulator(&c)
+				if err := s.run(); err != nil {
+					errs[i] = fmt.Errorf("replication %d (seed %d): %v", i+1, c.seed, err)
+				}
+				results[i] = s.stats.values()
+				covers[i] = s.cover
+			}
+		}()
+	}
+	for i := 0; i < k; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return results, covers, nil
+}
+
+// A summary is the mean of a statistic over several replications, with the
+// half-width of its 95% confidence interval.
+type summary struct {
+	name string
+	n    int
+	mean float64
+	sd   float64
+	half float64
+}
+
+// Two-sided 95% quantiles of Student's t distribution for 1 to 30 degrees of freedom.
+var t95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func tQuantile(df int) float64 {
+	if df <= len(t95) {
+		return t95[df-1]
+	}
+	return 1.96
+}
+
+// summarize combines the statistics of the replications, which all list the
+// same statistics in the same order.
+func summarize(results [][]statistic) []summary {
+	if len(results) == 0 {
+		return nil
+	}
+	sums := make([]summary, len(results[0]))
+	for i, v := range results[0] {
+		sums[i].name = v.name
+	}
+	for i := range sums {
+		x := &sums[i]
+		for _, r := range results {
+			x.mean += r[i].value
+		}
+		x.n = len(results)
+		x.mean /= float64(x.n)
+		if x.n > 1 {
+			ss := 0.0
+			for _, r := range results {
+				ss += (r[i].value - x.mean) * (r[i].value - x.mean)
+			}
+			x.sd = math.Sqrt(ss / float64(x.n-1))
+			x.half = tQuantile(x.n-1) * x.sd / math.Sqrt(float64(x.n))
+		}
+	}
+	return sums
+}
+
+func reportSummaries(w io.Writer, sums []summary) {
+	fmt.Fprintln(w, "statistic\tmean\t95% CI low\t95% CI high\tstd dev")
+	for _, x := range sums {
+		fmt.Fprintf(w, "%s\t%.4g\t%.4g\t%.4g\t%.4g\n", x.name, x.mean, x.mean-x.half, x.mean+x.half, x.sd)
+	}
+}
+
+// The replicate command runs independent replications and reports each
+// statistic's mean with a confidence interval.
+func replicateCommand(args []string) error {
+	cfg := newConfig()
+	fs := flag.NewFlagSet("replicate", flag.ExitOnError)
+	k := fs.Int("k", 30, "number of replications")
+	parallel := fs.Int("parallel", runtime.NumCPU(), "number of replications to run at once")
+	if err := parseFlags(fs, cfg, args); err != nil {
+		return err
+	}
+	if *k < 1 || *parallel < 1 {
+		return fmt.Errorf("k and parallel must be positive")
+	}
+	base := cfg.seed
+	if base == 0 {
+		base = time.Now().UnixNano()
+	}
+	fmt.Printf("%d replications, seed %d\n\n", *k, base)
+	results, covers, err := replicate(cfg, base, *k, *parallel)
+	if err != nil {
+		return err
+	}
+	reportSummaries(os.Stdout, summarize(results))
+	fmt.Println()
+	reportCoverage(os.Stdout, covers)
+	return nil
+}
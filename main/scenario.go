@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An arrival is what step U1 determines about a user who enters the system: the
+// time of entering, IN, OUT, and GIVEUPTIME. A list of arrivals in order of
+// time, set as the simulator's script, replaces the random users, so that a
+// particular trace (such as the one printed in the book) can be reproduced. A
+// scripted user may also be of one of the configured passenger classes.
+type arrival struct {
+	time       int
+	in         int
+	out        int
+	giveUpTime int
+	class      string
+}
+
+// A scenario is a script of users together with the options to run it with and
+// the events it is expected to produce. It is written one statement per line:
+//
+//	# a comment
+//	options -capacity 1 -bypass
+//	at 79 user 2 arrives floor 2 going 3 patience 400
+//	at 90 user 3 arrives floor 0 going 4 class wheelchair
+//	expect at 79 U2 arrives at doors closing
+//
+// Users must be numbered 1, 2, 3, ... in order of arrival, as U1 numbers them.
+// Without a patience, a user waits as long as any random user could. An
+// expectation is met by an event at that time in that step whose action
+// contains the rest of the line.
+type scenario struct {
+	name    string
+	options []string
+	script  []arrival
+	expects []expectation
+}
+
+type expectation struct {
+	line   int
+	time   int
+	step   string
+	action string
+}
+
+func (x expectation) String() string {
+	return strings.TrimSpace(fmt.Sprintf("at %d %s %s", x.time, x.step, x.action))
+}
+
+// writeScript writes arrivals in the form of a scenario, so that a script found
+// by a program can be saved and run again.
+func writeScript(w io.Writer, script []arrival) {
+	for i, a := range script {
+		fmt.Fprintf(w, "at %d user %d arrives floor %d going %d patience %d", a.time, i+1, a.in, a.out, a.giveUpTime)
+		if a.class != "" {
+			fmt.Fprintf(w, " class %s", a.class)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func loadScenario(name string) (*scenario, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseScenario(name, f)
+}
+
+func parseScenario(name string, r io.Reader) (*scenario, error) {
+	sc := &scenario{name: name}
+	lines := bufio.NewScanner(r)
+	for n := 1; lines.Scan(); n++ {
+		line := lines.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "options":
+			sc.options = append(sc.options, fields[1:]...)
+		case "at":
+			err = sc.parseArrival(fields)
+		case "expect":
+			err = sc.parseExpectation(n, fields)
+		default:
+			err = fmt.Errorf("unknown statement %q", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+	}
+	return sc, lines.Err()
+}
+
+// parseArrival reads "at TIME user N arrives floor IN going OUT [patience GIVEUPTIME] [class NAME]".
+func (sc *scenario) parseArrival(fields []string) error {
+	const form = "want: at TIME user N arrives floor IN going OUT [patience GIVEUPTIME] [class NAME]"
+	if len(fields) < 9 || fields[2] != "user" || fields[4] != "arrives" || fields[5] != "floor" || fields[7] != "going" {
+		return fmt.Errorf(form)
+	}
+	numbers := []string{fields[1], fields[3], fields[6], fields[8]}
+	class := ""
+	rest := fields[9:]
+	if len(rest) >= 2 && rest[0] == "patience" {
+		numbers = append(numbers, rest[1])
+		rest = rest[2:]
+	}
+	if len(rest) >= 2 && rest[0] == "class" {
+		class = rest[1]
+		rest = rest[2:]
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf(form)
+	}
+	x := []int{}
+	for _, f := range numbers {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < 0 {
+			return fmt.Errorf("%q is not a number; %s", f, form)
+		}
+		x = append(x, v)
+	}
+	// without a patience, the user waits as long as the most patient random user
+	a := arrival{time: x[0], in: x[2], out: x[3], giveUpTime: maxGiveUpTime - 1, class: class}
+	if len(x) == 5 {
+		a.giveUpTime = x[4]
+	}
+	if x[1] != len(sc.script)+1 {
+		return fmt.Errorf("user %d should be user %d", x[1], len(sc.script)+1)
+	}
+	if len(sc.script) > 0 && a.time < sc.script[len(sc.script)-1].time {
+		return fmt.Errorf("user %d arrives before user %d", x[1], x[1]-1)
+	}
+	if a.in == a.out {
+		return fmt.Errorf("user %d is already on floor %d", x[1], a.out)
+	}
+	sc.script = append(sc.script, a)
+	return nil
+}
+
+// parseExpectation reads "expect at TIME STEP [ACTION]".
+func (sc *scenario) parseExpectation(line int, fields []string) error {
+	if len(fields) < 4 || fields[1] != "at" {
+		return fmt.Errorf("want: expect at TIME STEP [ACTION]")
+	}
+	t, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return fmt.Errorf("%q is not a time", fields[2])
+	}
+	sc.expects = append(sc.expects, expectation{line, t, fields[3], strings.Join(fields[4:], " ")})
+	return nil
+}
+
+// configure applies the scenario's options to cfg and checks that its users fit
+// in the building.
+func (sc *scenario) configure(cfg *config) error {
+	fs := cfg.flagSet()
+	if err := fs.Parse(sc.options); err != nil {
+		return fmt.Errorf("%s: %v", sc.name, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: options line has a stray argument %q", sc.name, fs.Arg(0))
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("%s: %v", sc.name, err)
+	}
+	if len(cfg.groupSizes) > 0 {
+		return fmt.Errorf("%s: a scenario cannot have groups", sc.name)
+	}
+	for i, a := range sc.script {
+		if a.in >= cfg.floors || a.out >= cfg.floors {
+			return fmt.Errorf("%s: user %d is outside the building", sc.name, i+1)
+		}
+		if err := cfg.buttons.check(a.in, a.out); err != nil {
+			return fmt.Errorf("%s: user %d cannot call the elevator: %v", sc.name, i+1, err)
+		}
+		if a.class != "" && cfg.classes.lookup(a.class) == nil {
+			return fmt.Errorf("%s: user %d has an unknown class %q", sc.name, i+1, a.class)
+		}
+	}
+	return nil
+}
+
+// A checker collects the events of a run and tells which expectations they meet.
+type checker struct {
+	events []*event
+}
+
+func (c *checker) observe(_ *simulator, e *event) {
+	c.events = append(c.events, e)
+}
+
+func (c *checker) unmet(expects []expectation) []expectation {
+	var missing []expectation
+	for _, x := range expects {
+		met := false
+		for _, e := range c.events {
+			if e.time == x.time && e.step == x.step && strings.Contains(e.action, x.action) {
+				met = true
+				break
+			}
+		}
+		if !met {
+			missing = append(missing, x)
+		}
+	}
+	return missing
+}
+
+// run simulates the scenario with cfg, which configure has prepared, and
+// returns the expectations that were not met.
+func (sc *scenario) run(cfg *config, observers ...observer) (*simulator, []expectation, error) {
+	c := &checker{}
+	s := newSimulator(cfg)
+	s.script = append([]arrival{}, sc.script...)
+	s.observers = append(observers, c)
+	if err := s.run(); err != nil {
+		return s, nil, fmt.Errorf("%s: %v", sc.name, err)
+	}
+	return s, c.unmet(sc.expects), nil
+}
+
+// The scenario command runs scenario files and checks their expectations.
+func scenarioCommand(args []string) error {
+	cfg := newConfig()
+	fs := flag.NewFlagSet("scenario", flag.ExitOnError)
+	trace := fs.Bool("trace", false, "print the trace and statistics of each scenario")
+	if err := parseFlags(fs, cfg, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: scenario [options] file...")
+	}
+	failed := 0
+	for _, name := range fs.Args() {
+		sc, err := loadScenario(name)
+		if err != nil {
+			return err
+		}
+		c := *cfg
+		if err := sc.configure(&c); err != nil {
+			return err
+		}
+		var observers []observer
+		if *trace {
+			observers = append(observers, newTracePrinter(os.Stdout))
+		}
+		s, missing, err := sc.run(&c, observers...)
+		if err != nil {
+			return err
+		}
+		if *trace {
+			s.stats.report(os.Stdout)
+			fmt.Println()
+		}
+		if len(missing) == 0 {
+			fmt.Printf("ok\t%s\n", name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL\t%s\n", name)
+		for _, x := range missing {
+			fmt.Printf("\t%s:%d: no event %s\n", name, x.line, x)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", failed, fs.NArg())
+	}
+	return nil
+}
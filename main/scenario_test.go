@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseScenario(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"empty", "# nothing\n\n", ""},
+		{"arrival", "at 0 user 1 arrives floor 2 going 0", ""},
+		{"patience", "at 0 user 1 arrives floor 2 going 0 patience 40", ""},
+		{"class", "at 0 user 1 arrives floor 2 going 0 class cart", ""},
+		{"patience and class", "at 0 user 1 arrives floor 2 going 0 patience 40 class cart", ""},
+		{"class before patience", "at 0 user 1 arrives floor 2 going 0 class cart patience 40", "want: at TIME"},
+		{"expectation", "expect at 79 U2 arrives at doors closing", ""},
+		{"options", "options -capacity 1 -bypass", ""},
+		{"unknown statement", "wait 10", `unknown statement "wait"`},
+		{"misspelled", "at 0 user 1 comes floor 2 going 0", "want: at TIME"},
+		{"not a number", "at soon user 1 arrives floor 2 going 0", `"soon" is not a number`},
+		{"out of order", "at 0 user 2 arrives floor 2 going 0", "user 2 should be user 1"},
+		{"back in time", "at 50 user 1 arrives floor 2 going 0\nat 40 user 2 arrives floor 1 going 0", ":2: user 2 arrives before user 1"},
+		{"going nowhere", "at 0 user 1 arrives floor 2 going 2", "already on floor 2"},
+		{"expectation without step", "expect at 79", "want: expect at TIME STEP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseScenario("test", strings.NewReader(tt.text))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A user without a patience waits as long as the most patient random user.
+func TestScenarioDefaultPatience(t *testing.T) {
+	sc, err := parseScenario("test", strings.NewReader("at 0 user 1 arrives floor 2 going 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sc.script[0].giveUpTime; got != 1199 {
+		t.Errorf("patience %d, want 1199", got)
+	}
+}
+
+func TestScenarioConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"options", "options -capacity 1\nat 0 user 1 arrives floor 2 going 0", ""},
+		{"bad option", "options -lifts 2", "not defined"},
+		{"leftover argument", "options -capacity 1 bypass", `options line has a stray argument "bypass"`},
+		{"outside the building", "options -floors 3\nat 0 user 1 arrives floor 2 going 4", "user 1 is outside the building"},
+		{"groups", "options -groups 1,1", "cannot have groups"},
+		{"class", "options -classes cart:1:60\nat 0 user 1 arrives floor 2 going 0 class cart", ""},
+		{"unknown class", "options -classes cart:1:60\nat 0 user 1 arrives floor 2 going 0 class pram", `user 1 has an unknown class "pram"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := parseScenario("test", strings.NewReader(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sc.configure(newConfig())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmetExpectations(t *testing.T) {
+	sc, err := parseScenario("test", strings.NewReader(`
+at 0 user 1 arrives floor 2 going 0
+expect at 40 U5 User 1 gets in.
+expect at 41 U5 User 1 gets in.
+expect at 40 U6 User 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	if err := sc.configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, missing, err := sc.run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, x := range missing {
+		got = append(got, x.line)
+	}
+	if len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("unmet expectations on lines %v, want [4 5]", got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A sample describes the building at the end of one sampling interval.
+type sample struct {
+	time      int
+	queues    []int      // people waiting on each floor
+	onBoard   int        // people in the elevator
+	calls     int        // CALLUP, CALLDOWN and CALLCAR variables that are set
+	occupancy [3]float64 // fraction of the interval spent GOINGUP, GOINGDOWN, and NEUTRAL
+	gaveUp    int        // give-ups since the start of the run
+}
+
+// A sampler takes a sample every interval units of simulated time. It is
+// advanced by the simulation control before each jump of the clock, so the
+// sample at time t shows the state after everything that happened before t.
+type sampler struct {
+	interval  int
+	floors    int
+	samples   []*sample
+	last      int        // the time up to which occupancy has been counted
+	occupancy [3]float64 // time spent in each state during the current interval
+}
+
+func newSampler(interval int) *sampler {
+	return &sampler{interval: interval}
+}
+
+func (sm *sampler) advance(s *simulator, next int) {
+	sm.floors = s.cfg.floors
+	state := s.ele.state - stateGoingUp
+	for b := (sm.last/sm.interval + 1) * sm.interval; b <= next; b += sm.interval {
+		sm.occupancy[state] += float64(b - sm.last)
+		sm.last = b
+		x := &sample{
+			time:    b,
+			onBoard: s.ele.load,
+			gaveUp:  s.stats.gaveUp,
+		}
+		for j := range s.ele.queue {
+			x.queues = append(x.queues, s.ele.queue[j].length())
+			for _, c := range [][]bool{s.ele.callUp, s.ele.callDown, s.ele.callCar} {
+				if c[j] {
+					x.calls++
+				}
+			}
+		}
+		for i := range sm.occupancy {
+			x.occupancy[i] = sm.occupancy[i] / float64(sm.interval)
+			sm.occupancy[i] = 0
+		}
+		sm.samples = append(sm.samples, x)
+	}
+	sm.occupancy[state] += float64(next - sm.last)
+	sm.last = next
+}
+
+var occupancyStates = [3]string{"up", "down", "neutral"}
+
+func (sm *sampler) writeCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	header := []string{"time"}
+	for j := 0; j < sm.floors; j++ {
+		header = append(header, fmt.Sprintf("queue_%d", j))
+	}
+	header = append(header, "on_board", "calls")
+	for _, name := range occupancyStates {
+		header = append(header, name)
+	}
+	c.Write(append(header, "gave_up"))
+	for _, x := range sm.samples {
+		row := []string{strconv.Itoa(x.time)}
+		for _, q := range x.queues {
+			row = append(row, strconv.Itoa(q))
+		}
+		row = append(row, strconv.Itoa(x.onBoard), strconv.Itoa(x.calls))
+		for _, o := range x.occupancy {
+			row = append(row, strconv.FormatFloat(o, 'g', -1, 64))
+		}
+		c.Write(append(row, strconv.Itoa(x.gaveUp)))
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// writeMetrics writes the samples in the OpenMetrics text format, stamping each
+// with its simulated time in seconds, so that the file can be loaded into
+// Prometheus with promtool tsdb create-blocks-from openmetrics. Every series
+// has one sample per interval, in order of time, and the series of a metric
+// are written one after the other.
+func (sm *sampler) writeMetrics(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	type series struct {
+		labels string
+		value  func(x *sample) float64
+	}
+	metric := func(family, name, kind, help string, all ...series) {
+		fmt.Fprintf(b, "# TYPE %s %s\n# HELP %s %s\n", family, kind, family, help)
+		for _, sr := range all {
+			for _, x := range sm.samples {
+				fmt.Fprintf(b, "%s%s %g %s\n", name, sr.labels, sr.value(x), strconv.FormatFloat(float64(x.time)/10, 'f', -1, 64))
+			}
+		}
+	}
+	gauge := func(name, help string, all ...series) {
+		metric(name, name, "gauge", help, all...)
+	}
+	var queues []series
+	for j := 0; j < sm.floors; j++ {
+		j := j
+		queues = append(queues, series{fmt.Sprintf("{floor=\"%d\"}", j), func(x *sample) float64 { return float64(x.queues[j]) }})
+	}
+	gauge("elevator_queue_length", "People waiting for the elevator on each floor.", queues...)
+	gauge("elevator_passengers_on_board", "People in the elevator.",
+		series{"", func(x *sample) float64 { return float64(x.onBoard) }})
+	gauge("elevator_calls_outstanding", "Call buttons that are lit.",
+		series{"", func(x *sample) float64 { return float64(x.calls) }})
+	var occupancy []series
+	for i, state := range occupancyStates {
+		i := i
+		occupancy = append(occupancy, series{fmt.Sprintf("{state=\"%s\"}", state), func(x *sample) float64 { return x.occupancy[i] }})
+	}
+	gauge("elevator_state_occupancy_ratio", "Fraction of the interval the elevator spent in each state.", occupancy...)
+	metric("elevator_give_ups", "elevator_give_ups_total", "counter", "Users who gave up waiting.",
+		series{"", func(x *sample) float64 { return float64(x.gaveUp) }})
+	fmt.Fprintln(b, "# EOF")
+	return b.Flush()
+}
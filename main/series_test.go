@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The metrics file is OpenMetrics: timestamps in seconds, each series written
+// whole in order of time, and an EOF marker at the end.
+func TestWriteMetrics(t *testing.T) {
+	cfg := newConfig()
+	cfg.seed = 1
+	cfg.duration = 2000
+	s := newSimulator(cfg)
+	s.sampler = newSampler(100)
+	if err := s.run(); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := s.sampler.writeMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if last := lines[len(lines)-1]; last != "# EOF" {
+		t.Errorf("last line %q, want # EOF", last)
+	}
+	if !strings.Contains(b.String(), "# TYPE elevator_give_ups counter\n") {
+		t.Error("no counter family elevator_give_ups")
+	}
+	done := map[string]bool{}
+	series, previous := "", -1.0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("line %q", line)
+		}
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fields[0] != series {
+			if done[fields[0]] {
+				t.Fatalf("series %s is interleaved with others", fields[0])
+			}
+			done[series] = true
+			series, previous = fields[0], -1
+		}
+		if ts <= previous {
+			t.Fatalf("%s: timestamp %g after %g", series, ts, previous)
+		}
+		previous = ts
+	}
+	done[series] = true
+	delete(done, "")
+	if previous != 200 {
+		t.Errorf("last timestamp %g, want 200 seconds", previous)
+	}
+	if len(done) != cfg.floors+6 {
+		t.Errorf("%d series, want %d", len(done), cfg.floors+6)
+	}
+}
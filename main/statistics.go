@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// statistics counts what happened to the users over a run.
+type statistics struct {
+	arrivals          int // users who entered the system in U1
+	redrawnArrivals   int // random trips drawn again because the floor has no call button for them
+	delivered         int // users who got out at their destination in U6
+	gaveUp            int // users who ran out of patience in U4
+	balked            int // users who walked at once because the queue was too long
+	tookStairs        int // users who walked at once because the trip was only one floor
+	wrongWayBoardings int // users who got in while the elevator was going the other way
+	wrongWayFloors    int // floors traveled away from their destination, over everyone on board
+	leftBehind        int // users still waiting when the elevator departed from their floor
+	repressed         int // calls pressed again after E6 turned them off
+	canceledCalls     int // hall calls turned off because everyone waiting for them gave up
+	phantomStops      int // stops in E2 for a hall call with nobody waiting
+
+	boarded          int // users who got into the elevator in U5
+	waitTime         int // total time from arrival until getting in, over the boarded users
+	walkers          int // users who went by the stairs instead (gave up, balked, or took the stairs)
+	riderJourneyTime int // total time from arrival until getting out, over the delivered users
+	walkJourneyTime  int // total time from arrival until reaching OUT by the stairs, over the walkers
+	transfers        int // people who got out or in at E4
+	transferTime     int // total time E4 waited for them
+
+	groups           int // groups of two or more users whose last member has left the system
+	groupMembers     int // users in those groups
+	splitGroups      int // groups whose members did not all leave on the same elevator trip
+	groupJourneyTime int // total time from a group's arrival until its last member reached the destination
+
+	doorTime   [doorStates]int // total time the doors spent in each state
+	doorVisits [doorStates]int // number of times the doors entered each state
+}
+
+type statistic struct {
+	name  string
+	value float64
+}
+
+func (st *statistics) values() []statistic {
+	values := []statistic{
+		{"arrivals", float64(st.arrivals)},
+		{"arrivals redrawn", float64(st.redrawnArrivals)},
+		{"delivered", float64(st.delivered)},
+		{"gave up", float64(st.gaveUp)},
+		{"balked", float64(st.balked)},
+		{"took stairs", float64(st.tookStairs)},
+		{"wrong-way boardings", float64(st.wrongWayBoardings)},
+		{"wrong-way floors ridden", float64(st.wrongWayFloors)},
+		{"left behind", float64(st.leftBehind)},
+		{"calls pressed again", float64(st.repressed)},
+		{"canceled calls", float64(st.canceledCalls)},
+		{"phantom stops", float64(st.phantomStops)},
+		{"mean wait time", ratio(st.waitTime, st.boarded)},
+		{"mean elevator journey time", ratio(st.riderJourneyTime, st.delivered)},
+		{"mean stairs journey time", ratio(st.walkJourneyTime, st.walkers)},
+		{"mean journey time", ratio(st.riderJourneyTime+st.walkJourneyTime, st.delivered+st.walkers)},
+		{"mean transfer time", ratio(st.transferTime, st.transfers)},
+		{"groups", float64(st.groups)},
+		{"mean group size", ratio(st.groupMembers, st.groups)},
+		{"split groups", float64(st.splitGroups)},
+		{"mean group journey time", ratio(st.groupJourneyTime, st.groups)},
+	}
+	for d, name := range doorNames {
+		values = append(values,
+			statistic{"doors " + name + " time", float64(st.doorTime[d])},
+			statistic{"doors " + name + " mean dwell", ratio(st.doorTime[d], st.doorVisits[d])})
+	}
+	return values
+}
+
+// ratio is a mean that is zero when there is nothing to average.
+func ratio(sum, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count)
+}
+
+func (st *statistics) report(w io.Writer) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "statistic\tvalue")
+	for _, v := range st.values() {
+		fmt.Fprintf(w, "%s\t%g\n", v.name, v.value)
+	}
+}
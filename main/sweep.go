@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A dimension is one option varied by a sweep, with the values it takes. The
+// name is that of a command-line option, so anything that can be set on the
+// command line can be swept.
+type dimension struct {
+	name   string
+	values []string
+}
+
+// parseDimension reads name=v1;v2;... or name=lo:hi[:step], where the range
+// includes both ends and the step defaults to 1. The values are separated by
+// semicolons because -groups, -buttons, and -classes take commas, and only
+// numbers make a range because a class has colons too.
+func parseDimension(spec string) (dimension, error) {
+	name, list, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || list == "" {
+		return dimension{}, fmt.Errorf("%q is not name=values", spec)
+	}
+	if name == "seed" {
+		return dimension{}, fmt.Errorf("the seed cannot be varied; replications have seeds of their own")
+	}
+	if newConfig().flagSet().Lookup(name) == nil {
+		return dimension{}, fmt.Errorf("unknown option %q", name)
+	}
+	d := dimension{name: name}
+	bounds := strings.Split(list, ":")
+	x, isRange := []float64{0, 0, 1}, len(bounds) == 2 || len(bounds) == 3
+	for i := 0; isRange && i < len(bounds); i++ {
+		v, err := strconv.ParseFloat(bounds[i], 64)
+		x[i], isRange = v, err == nil
+	}
+	if !isRange {
+		d.values = strings.Split(list, ";")
+		return d, nil
+	}
+	lo, hi, step := x[0], x[1], x[2]
+	if step <= 0 || hi < lo {
+		return dimension{}, fmt.Errorf("%q is an empty range", list)
+	}
+	for i := 0; lo+float64(i)*step <= hi+step*1e-9; i++ {
+		d.values = append(d.values, strconv.FormatFloat(lo+float64(i)*step, 'g', -1, 64))
+	}
+	return d, nil
+}
+
+// flagSet binds the shared options to the configuration so that they can be
+// set and read by name.
+func (c *config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.registerFlags(fs)
+	return fs
+}
+
+// options lists the shared options in which c differs from the defaults, in the
+// form of command-line arguments. The seed is left out.
+func (c *config) options() []string {
+	defaults := newConfig().flagSet()
+	var args []string
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		if f.Name != "seed" && f.Value.String() != defaults.Lookup(f.Name).Value.String() {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// grid is the cartesian product of the dimensions, as indexes into their values.
+func grid(dims []dimension) [][]int {
+	points := [][]int{{}}
+	for _, d := range dims {
+		var next [][]int
+		for _, p := range points {
+			for i := range d.values {
+				next = append(next, append(append([]int{}, p...), i))
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// latinHypercube picks n points so that, in every dimension, each of n equal
+// strata of the values holds exactly one point.
+func latinHypercube(dims []dimension, n int, random *rand.Rand) [][]int {
+	points := make([][]int, n)
+	for i := range points {
+		points[i] = make([]int, len(dims))
+	}
+	for k, d := range dims {
+		for i, stratum := range random.Perm(n) {
+			x := (float64(stratum) + random.Float64()) / float64(n)
+			points[i][k] = int(x * float64(len(d.values)))
+		}
+	}
+	return points
+}
+
+// csvName turns the name of a statistic into a column name.
+func csvName(name string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+// The sweep command runs replications of every combination of the varied
+// options and writes one row per run, ready for a data frame.
+func sweepCommand(args []string) error {
+	cfg := newConfig()
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	var dims []dimension
+	fs.Func("vary", "option to vary, as name=v1;v2;... or name=lo:hi[:step] (repeatable)", func(spec string) error {
+		d, err := parseDimension(spec)
+		if err == nil {
+			dims = append(dims, d)
+		}
+		return err
+	})
+	design := fs.String("design", "grid", "grid (every combination) or lhs (Latin hypercube)")
+	samples := fs.Int("samples", 10, "number of combinations in a Latin hypercube")
+	k := fs.Int("k", 10, "number of replications of each combination")
+	parallel := fs.Int("parallel", runtime.NumCPU(), "number of replications to run at once")
+	out := fs.String("out", "", "write the results to this file instead of standard output")
+	if err := parseFlags(fs, cfg, args); err != nil {
+		return err
+	}
+	if *k < 1 || *parallel < 1 || *samples < 1 {
+		return fmt.Errorf("k, parallel, and samples must be positive")
+	}
+	base := cfg.seed
+	if base == 0 {
+		base = time.Now().UnixNano()
+	}
+	var points [][]int
+	switch *design {
+	case "grid":
+		points = grid(dims)
+	case "lhs":
+		points = latinHypercube(dims, *samples, rand.New(rand.NewSource(base)))
+	default:
+		return fmt.Errorf("unknown design %q", *design)
+	}
+
+	// Check every combination before running any of them.
+	configs := make([]*config, len(points))
+	for i, p := range points {
+		c := *cfg
+		fs := c.flagSet()
+		for j, d := range dims {
+			if err := fs.Set(d.name, d.values[p[j]]); err != nil {
+				return fmt.Errorf("-%s=%s: %v", d.name, d.values[p[j]], err)
+			}
+		}
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("combination %d: %v", i+1, err)
+		}
+		configs[i] = &c
+	}
+
+	write := func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		header := []string{"config"}
+		for _, d := range dims {
+			header = append(header, d.name)
+		}
+		header = append(header, "replication", "seed")
+		for _, v := range newSimulator(cfg).stats.values() {
+			header = append(header, csvName(v.name))
+		}
+		cw.Write(header)
+		for i, c := range configs {
+			results, _, err := replicate(c, base, *k, *parallel)
+			if err != nil {
+				return fmt.Errorf("combination %d: %v", i+1, err)
+			}
+			for r, stats := range results {
+				row := []string{strconv.Itoa(i + 1)}
+				for j, d := range dims {
+					row = append(row, d.values[points[i][j]])
+				}
+				row = append(row, strconv.Itoa(r+1), strconv.FormatInt(deriveSeed(base, r), 10))
+				for _, v := range stats {
+					row = append(row, strconv.FormatFloat(v.value, 'g', -1, 64))
+				}
+				cw.Write(row)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	if *out == "" {
+		return write(os.Stdout)
+	}
+	return writeFile(*out, write)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDimension(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{"policy=knuth;nearest", []string{"knuth", "nearest"}, false},
+		{"autoclose=40:100:20", []string{"40", "60", "80", "100"}, false},
+		{"capacity=1:3", []string{"1", "2", "3"}, false},
+		{"groups=1;2,1;1,1,1", []string{"1", "2,1", "1,1,1"}, false},
+		{"buttons=U,UD,UD,UD,D;U,UD,-,UD,D", []string{"U,UD,UD,UD,D", "U,UD,-,UD,D"}, false},
+		{"classes=cart:1:60;cart:1:60,walking:3:25", []string{"cart:1:60", "cart:1:60,walking:3:25"}, false},
+		{"capacity=3:1", nil, true},
+		{"seed=1;2", nil, true},
+		{"lifts=1;2", nil, true},
+		{"capacity", nil, true},
+	}
+	for _, tt := range tests {
+		d, err := parseDimension(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tt.spec)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+		} else if !reflect.DeepEqual(d.values, tt.want) {
+			t.Errorf("%s: values %q, want %q", tt.spec, d.values, tt.want)
+		}
+	}
+}
+
+// A sweep over -groups runs each grouping as a value of its own.
+func TestSweepGroups(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "sweep.csv")
+	err := sweepCommand([]string{"-vary", "groups=1;2,1", "-k", "1", "-seed", "1", "-duration", "3000", "-out", out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want a header and 2 runs", len(rows))
+	}
+	if rows[0][1] != "groups" || rows[1][1] != "1" || rows[2][1] != "2,1" {
+		t.Fatalf("varied %s over %q and %q, want groups over 1 and 2,1", rows[0][1], rows[1][1], rows[2][1])
+	}
+	// the statistic of the same name counts the groups that arrived
+	groups := len(rows[0]) - 1
+	for groups > 1 && rows[0][groups] != "groups" {
+		groups--
+	}
+	if rows[1][groups] != "0" || rows[2][groups] == "0" {
+		t.Errorf("%s and %s groups arrived, want none and some", rows[1][groups], rows[2][groups])
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// scenarioTrace runs the named scenario in testdata and returns its trace. The
+// statistics are left out: they are not part of the trace. It fails the test if
+// an expectation of the scenario is not met or an invariant is broken.
+func scenarioTrace(t *testing.T, name string) string {
+	t.Helper()
+	sc, err := loadScenario(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig()
+	if err := sc.configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	v := &invariants{}
+	s, missing, err := sc.run(cfg, newTracePrinter(&b), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range missing {
+		t.Errorf("%s:%d: no event %s", sc.name, x.line, x)
+	}
+	v.finish(s)
+	for _, p := range v.problems {
+		t.Errorf("%s: %s", sc.name, p)
+	}
+	return b.String()
+}
+
+// compareGolden compares got with the named file in testdata line by line, or
+// rewrites the file if the -update flag is given.
+func compareGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		if gotLines[i] != wantLines[i] {
+			t.Fatalf("%s:%d:\n got: %s\nwant: %s", path, i+1, gotLines[i], wantLines[i])
+		}
+	}
+	if len(gotLines) != len(wantLines) {
+		t.Fatalf("%s: got %d lines, want %d", path, len(gotLines), len(wantLines))
+	}
+}
+
+// The golden trace of the README example was checked by hand against the
+// example output in the README, which the original program printed before any
+// of the options were added.
+func TestReadmeTrace(t *testing.T) {
+	compareGolden(t, "readme.golden", scenarioTrace(t, "readme.scenario"))
+}
+
+func TestScenarios(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.scenario"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			scenarioTrace(t, filepath.Base(name))
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tuiSpeeds are the playback rates offered by the terminal view, as multiples of real time.
+var tuiSpeeds = []int{1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+const tuiRecent = 8 // number of trace lines shown below the building
+
+// tui draws the building in the terminal after every event and paces the
+// simulation so it can be watched. It reads single keystrokes to pause, step,
+// change speed, and quit.
+type tui struct {
+	out    *bufio.Writer
+	keys   chan byte
+	speed  int // index into tuiSpeeds
+	paused bool
+	last   int // simulated time of the previous event
+	recent []string
+}
+
+func newTUI(speed int, paused bool) *tui {
+	t := &tui{
+		out:    bufio.NewWriter(os.Stdout),
+		keys:   make(chan byte),
+		paused: paused,
+	}
+	for t.speed < len(tuiSpeeds)-1 && tuiSpeeds[t.speed] < speed {
+		t.speed++
+	}
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(buf); err != nil {
+				close(t.keys)
+				return
+			} else if n == 1 {
+				t.keys <- buf[0]
+			}
+		}
+	}()
+	return t
+}
+
+func (t *tui) observe(s *simulator, e *event) {
+	t.recent = append(t.recent, fmt.Sprintf("%04d  %s  %s", e.time, e.step, e.action))
+	if len(t.recent) > tuiRecent {
+		t.recent = t.recent[1:]
+	}
+	// Let the simulated time between events pass, plus a short pause so that
+	// several events at the same instant can still be followed.
+	delay := time.Duration(e.time-t.last)*100*time.Millisecond + 200*time.Millisecond
+	t.last = e.time
+	t.wait(s, delay/time.Duration(tuiSpeeds[t.speed]))
+	t.draw(s, e)
+}
+
+// wait sleeps for the given real time while handling keystrokes. While paused,
+// it returns only when the user asks for the next event.
+func (t *tui) wait(s *simulator, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for !s.stopped {
+		if t.paused {
+			if t.key(s, <-t.keys) {
+				return
+			}
+			continue
+		}
+		select {
+		case k := <-t.keys:
+			t.key(s, k)
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// key acts on a keystroke and reports whether it asked for a single step.
+func (t *tui) key(s *simulator, k byte) bool {
+	switch k {
+	case ' ', 'p':
+		t.paused = !t.paused
+	case 'n':
+		return t.paused
+	case '+', '=':
+		if t.speed < len(tuiSpeeds)-1 {
+			t.speed++
+		}
+	case '-', '_':
+		if t.speed > 0 {
+			t.speed--
+		}
+	case 'q', 0:
+		s.stopped = true
+	}
+	t.draw(s, nil)
+	return false
+}
+
+func carGlyph(ele *elevator) string {
+	var left, right string
+	switch ele.doors {
+	case doorsOpening, doorsReopening:
+		left, right = "[<", ">]"
+	case doorsClosing:
+		left, right = "[>", "<]"
+	case doorsClosed:
+		left, right = "[=", "=]"
+	default:
+		left, right = "[ ", " ]"
+	}
+	return fmt.Sprintf("%s%2d%s", left, ele.load, right)
+}
+
+func userIDs(list *node, limit int) string {
+	var b strings.Builder
+	n := 0
+	for p := list.rlink; p != list; p = p.rlink {
+		if n == limit {
+			fmt.Fprintf(&b, " +%d", list.length()-n)
+			break
+		}
+		fmt.Fprintf(&b, " %d", p.info.(*user).id)
+		n++
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (t *tui) draw(s *simulator, e *event) {
+	ele := s.ele
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	line := func(format string, a ...interface{}) {
+		fmt.Fprintf(&b, format, a...)
+		b.WriteString("\x1b[K\r\n")
+	}
+	status := "running"
+	if t.paused {
+		status = "paused"
+	}
+	line("Knuth's elevator    time %04d    speed %dx    %s", s.time, tuiSpeeds[t.speed], status)
+	line("STATE %c   D1 %c   D2 %c   D3 %c   doors %s", stateRune(ele.state), flagRune(ele.doors.d1()),
+		flagRune(ele.d2), flagRune(ele.doors.d3()), ele.doors)
+	line("")
+	line("floor  hall  car   shaft      waiting")
+	for j := len(ele.queue) - 1; j >= 0; j-- {
+		up, down, car := '.', '.', ' '
+		if ele.callUp[j] {
+			up = '^'
+		}
+		if ele.callDown[j] {
+			down = 'v'
+		}
+		if ele.callCar[j] {
+			car = '*'
+		}
+		shaft := "        "
+		if ele.floor == j {
+			shaft = carGlyph(ele)
+			switch ele.step {
+			case stepGoUpAFloor:
+				shaft += "^"
+			case stepGoDownAFloor:
+				shaft += "v"
+			}
+		}
+		line("  %d    %c %c    %c    |%-9s|  %s", j, up, down, car, shaft, userIDs(ele.queue[j], 12))
+	}
+	line("")
+	line("on board: %s", userIDs(ele.stack, 16))
+	line("")
+	for i := 0; i < tuiRecent; i++ {
+		if i < len(t.recent) {
+			line("%s", t.recent[i])
+		} else {
+			line("")
+		}
+	}
+	line("")
+	line("space pause/resume   n next event   + faster   - slower   q quit")
+	b.WriteString("\x1b[J")
+	t.out.WriteString(b.String())
+	t.out.Flush()
+}
+
+// stty switches the terminal attached to standard input to the given settings
+// and returns the previous ones.
+func stty(args ...string) (string, error) {
+	save := exec.Command("stty", "-g")
+	save.Stdin = os.Stdin
+	state, err := save.Output()
+	if err != nil {
+		return "", errors.New("the tui command needs a terminal")
+	}
+	set := exec.Command("stty", args...)
+	set.Stdin = os.Stdin
+	if err := set.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(state)), nil
+}
+
+// The tui command shows the simulation as an animated picture of the shaft.
+func tuiCommand(args []string) error {
+	cfg := newConfig()
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	speed := fs.Int("speed", 10, "playback speed as a multiple of real time")
+	paused := fs.Bool("paused", false, "start paused")
+	if err := parseFlags(fs, cfg, args); err != nil {
+		return err
+	}
+	state, err := stty("-icanon", "-echo", "min", "1")
+	if err != nil {
+		return err
+	}
+	// The terminal is put back however the command ends: normally, by a
+	// panic, or by an interrupt, which -icanon leaves enabled.
+	var once sync.Once
+	restore := func() (err error) {
+		once.Do(func() {
+			fmt.Print("\x1b[?25h\x1b[?1049l")
+			if _, e := stty(state); e != nil {
+				err = fmt.Errorf("cannot restore the terminal: %v", e)
+			}
+		})
+		return err
+	}
+	defer func() {
+		if err := restore(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(interrupt)
+		close(interrupt)
+	}()
+	go func() {
+		if _, ok := <-interrupt; ok {
+			if err := restore(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(130)
+		}
+	}()
+	t := newTUI(*speed, *paused)
+	fmt.Print("\x1b[?1049h\x1b[?25l\x1b[2J")
+	s := newSimulator(cfg)
+	s.observers = append(s.observers, t)
+	err = s.run()
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return err
+	}
+	s.stats.report(os.Stdout)
+	return nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// snapshot is the JSON form of an event sent to the browser, together with
+// the parts of the building that the page draws.
+type snapshot struct {
+	Time     int     `json:"time"`
+	State    string  `json:"state"`
+	Floor    int     `json:"floor"`
+	D1       bool    `json:"d1"`
+	D2       bool    `json:"d2"`
+	D3       bool    `json:"d3"`
+	Step     string  `json:"step"`
+	Action   string  `json:"action"`
+	Doors    string  `json:"doors"`
+	CallUp   []bool  `json:"callUp"`
+	CallDown []bool  `json:"callDown"`
+	CallCar  []bool  `json:"callCar"`
+	Queues   [][]int `json:"queues"`
+	Riders   []int   `json:"riders"`
+	MeanWait float64 `json:"meanWait"`
+	GaveUp   int     `json:"gaveUp"`
+}
+
+func userIDList(list *node) []int {
+	ids := []int{}
+	for p := list.rlink; p != list; p = p.rlink {
+		ids = append(ids, p.info.(*user).id)
+	}
+	return ids
+}
+
+func newSnapshot(s *simulator, e *event) *snapshot {
+	v := &snapshot{
+		Time:     e.time,
+		State:    string(stateRune(e.state)),
+		Floor:    e.floor,
+		D1:       e.d1,
+		D2:       e.d2,
+		D3:       e.d3,
+		Step:     e.step,
+		Action:   e.action,
+		Doors:    s.ele.doors.String(),
+		CallUp:   s.ele.callUp,
+		CallDown: s.ele.callDown,
+		CallCar:  s.ele.callCar,
+		Riders:   userIDList(s.ele.stack),
+		MeanWait: ratio(s.stats.waitTime, s.stats.boarded),
+		GaveUp:   s.stats.gaveUp,
+	}
+	for _, q := range s.ele.queue {
+		v.Queues = append(v.Queues, userIDList(q))
+	}
+	return v
+}
+
+// eventStream sends every event to a browser as a Server-Sent Event, pacing the
+// simulation like the terminal view does.
+type eventStream struct {
+	w     io.Writer
+	flush func()
+	ctx   context.Context
+	speed int
+	last  int
+}
+
+func (es *eventStream) observe(s *simulator, e *event) {
+	delay := time.Duration(e.time-es.last) * 100 * time.Millisecond / time.Duration(es.speed)
+	es.last = e.time
+	select {
+	case <-es.ctx.Done():
+		s.stopped = true
+		return
+	case <-time.After(delay):
+	}
+	es.send("", newSnapshot(s, e))
+}
+
+func (es *eventStream) send(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if name != "" {
+		fmt.Fprintf(es.w, "event: %s\n", name)
+	}
+	fmt.Fprintf(es.w, "data: %s\n\n", data)
+	es.flush()
+}
+
+// eventFlags is the flag set of /events: the options of the command line, bound
+// to cfg, and the playback speed.
+func eventFlags(cfg *config) (*flag.FlagSet, *int) {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	speed := fs.Int("speed", 10, "playback speed as a multiple of real time")
+	return fs, speed
+}
+
+// serveEvents runs a fresh simulation for each connection. The query string
+// holds the same options as the command line, e.g. /events?capacity=4&speed=20.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	cfg := newConfig()
+	fs, speed := eventFlags(cfg)
+	var args []string
+	for name, values := range r.URL.Query() {
+		for _, value := range values {
+			args = append(args, "-"+name+"="+value)
+		}
+	}
+	if err := parseFlags(fs, cfg, args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if *speed < 1 {
+		*speed = 1
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	es := &eventStream{w: w, flush: flusher.Flush, ctx: r.Context(), speed: *speed}
+	s := newSimulator(cfg)
+	s.observers = append(s.observers, es)
+	if err := s.run(); err != nil {
+		es.send("failure", err.Error())
+		return
+	}
+	if !s.stopped {
+		var stats [][2]interface{}
+		for _, v := range s.stats.values() {
+			stats = append(stats, [2]interface{}{v.name, v.value})
+		}
+		es.send("stats", stats)
+	}
+}
+
+// A formField is a control of the dashboard's form for one option of /events.
+type formField struct {
+	Name    string
+	Usage   string
+	Default string
+	Kind    string   // "select", "number", or "text"
+	Choices []string // the values a select offers
+}
+
+// formFields lists a control for every option that /events takes, so the form
+// keeps up with the options of the command line. A blank text or number leaves
+// the option at its default.
+func formFields() []formField {
+	fs, _ := eventFlags(newConfig())
+	newConfig().registerFlags(fs)
+	choices := map[string][]string{
+		"policy":   policyNames(),
+		"boarding": {boardingKnuth, boardingDirection},
+		"engine":   {engineCallbacks, engineProcesses},
+	}
+	var fields []formField
+	fs.VisitAll(func(f *flag.Flag) {
+		field := formField{Name: f.Name, Usage: f.Usage, Default: f.DefValue, Kind: "text", Choices: choices[f.Name]}
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch g.Get().(type) {
+			case bool:
+				field.Choices = []string{"false", "true"}
+			case int, int64, float64:
+				field.Kind = "number"
+			}
+		}
+		if field.Choices != nil {
+			field.Kind = "select"
+		}
+		fields = append(fields, field)
+	})
+	return fields
+}
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboard.Execute(w, formFields()); err != nil {
+		log.Print(err)
+	}
+}
+
+// The serve command runs simulations for a dashboard in the browser.
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveDashboard)
+	mux.HandleFunc("/events", serveEvents)
+	log.Printf("dashboard at http://%s/", *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+var dashboard = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Knuth's Elevator</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+form label { margin-right: 1em; white-space: nowrap; }
+form label { display: inline-block; margin-bottom: 0.3em; }
+form input[type=number], form input[type=text] { width: 6em; }
+#panels { display: flex; gap: 1em; margin-top: 1em; }
+canvas { border: 1px solid #ccc; }
+#log { font-family: monospace; font-size: 12px; height: 360px; width: 40em; overflow-y: scroll; white-space: pre; border: 1px solid #ccc; }
+#stats td { padding: 0 1em 0 0; }
+</style>
+</head>
+<body>
+<h1>Knuth's Elevator</h1>
+<form id="options">
+{{range .}}<label title="{{.Usage}}">{{.Name}}
+{{- if eq .Kind "select"}} <select name="{{.Name}}">{{$d := .Default}}{{range .Choices}}<option{{if eq . $d}} selected{{end}}>{{.}}</option>{{end}}</select>
+{{- else if eq .Kind "number"}} <input type="number" name="{{.Name}}" step="any" placeholder="{{.Default}}"{{if eq .Name "speed"}} value="20"{{end}}>
+{{- else}} <input type="text" name="{{.Name}}" placeholder="{{.Default}}">
+{{- end}}</label>
+{{end}}<button>Start</button>
+</form>
+<div id="panels">
+<canvas id="building" width="360" height="360"></canvas>
+<div>
+<canvas id="queueChart" width="420" height="170"></canvas><br>
+<canvas id="waitChart" width="420" height="170"></canvas>
+</div>
+<div id="log"></div>
+</div>
+<table id="stats"></table>
+<script>
+const form = document.getElementById('options');
+const log = document.getElementById('log');
+let source = null;
+let history = [];
+const maxHistory = 2000; // points kept for the charts; every other one is dropped beyond that
+
+form.onsubmit = function(e) {
+	e.preventDefault();
+	if (source) source.close();
+	history = [];
+	log.textContent = '';
+	document.getElementById('stats').innerHTML = '';
+	const params = new URLSearchParams();
+	for (const [k, v] of new FormData(form)) {
+		if (v !== '') params.append(k, v);
+	}
+	source = new EventSource('/events?' + params);
+	source.onmessage = function(m) {
+		const e = JSON.parse(m.data);
+		let waiting = 0;
+		for (const q of e.queues) waiting += q.length;
+		history.push({time: e.time, waiting: waiting, meanWait: e.meanWait / 10});
+		if (history.length > maxHistory) {
+			history = history.filter(function(p, i) { return i % 2 === 1 || i === history.length - 1; });
+		}
+		drawBuilding(e);
+		drawChart('queueChart', 'people waiting', 'waiting');
+		drawChart('waitChart', 'mean wait (s)', 'meanWait');
+		const t = String(e.time).padStart(4, '0');
+		log.textContent += t + ' ' + e.state + ' ' + e.floor + ' ' + e.step + ' ' + e.action + '\n';
+		log.scrollTop = log.scrollHeight;
+	};
+	source.addEventListener('stats', function(m) {
+		const stats = JSON.parse(m.data);
+		const table = document.getElementById('stats');
+		for (const [name, value] of stats) {
+			const row = table.insertRow();
+			row.insertCell().textContent = name;
+			row.insertCell().textContent = Math.round(value * 100) / 100;
+		}
+		source.close();
+	});
+	source.addEventListener('failure', function(m) {
+		log.textContent += 'ERROR: ' + JSON.parse(m.data) + '\n';
+		source.close();
+	});
+	source.onerror = function() { source.close(); };
+};
+
+function drawBuilding(e) {
+	const c = document.getElementById('building').getContext('2d');
+	const floors = e.callUp.length;
+	const h = 360 / floors;
+	c.clearRect(0, 0, 360, 360);
+	c.font = '12px sans-serif';
+	for (let j = 0; j < floors; j++) {
+		const y = 360 - (j + 1) * h;
+		c.strokeStyle = '#ccc';
+		c.strokeRect(0, y, 360, h);
+		c.fillStyle = '#000';
+		c.fillText('floor ' + j, 4, y + 14);
+		lamp(c, 60, y + h / 2 - 8, e.callUp[j], true);
+		lamp(c, 60, y + h / 2 + 8, e.callDown[j], false);
+		if (e.callCar[j]) {
+			c.fillStyle = '#e80';
+			c.beginPath();
+			c.arc(228, y + h / 2, 4, 0, 2 * Math.PI);
+			c.fill();
+		}
+		c.fillStyle = '#36c';
+		e.queues[j].forEach(function(id, i) {
+			c.beginPath();
+			c.arc(90 + i * 14, y + h - 10, 5, 0, 2 * Math.PI);
+			c.fill();
+		});
+	}
+	c.strokeStyle = '#000';
+	c.strokeRect(240, 0, 80, 360);
+	const y = 360 - (e.floor + 1) * h;
+	c.fillStyle = e.doors === 'closed' ? '#888' : '#cde';
+	c.fillRect(244, y + 4, 72, h - 8);
+	if (e.doors !== 'closed') {
+		const gap = e.doors === 'opening' || e.doors === 'reopening' || e.doors === 'closing' ? 10 : 30;
+		c.fillStyle = '#fff';
+		c.fillRect(280 - gap, y + 4, 2 * gap, h - 8);
+	}
+	c.fillStyle = '#000';
+	c.fillText(e.riders.length + ' on board', 248, y + h / 2);
+	c.fillText(e.state === 'U' ? '▲' : e.state === 'D' ? '▼' : '●', 326, y + h / 2);
+}
+
+function lamp(c, x, y, lit, up) {
+	c.fillStyle = lit ? '#fc0' : '#eee';
+	c.strokeStyle = '#999';
+	c.beginPath();
+	c.moveTo(x - 6, up ? y + 4 : y - 4);
+	c.lineTo(x + 6, up ? y + 4 : y - 4);
+	c.lineTo(x, up ? y - 5 : y + 5);
+	c.closePath();
+	c.fill();
+	c.stroke();
+}
+
+function drawChart(id, title, key) {
+	const c = document.getElementById(id).getContext('2d');
+	const w = 420, h = 170, pad = 24;
+	c.clearRect(0, 0, w, h);
+	c.fillStyle = '#000';
+	c.font = '12px sans-serif';
+	c.fillText(title, pad, 14);
+	if (history.length === 0) return;
+	const tmax = Math.max(1, history[history.length - 1].time);
+	let vmax = 1;
+	for (const p of history) vmax = Math.max(vmax, p[key]);
+	c.fillText(String(Math.round(vmax)), 2, pad);
+	c.strokeStyle = '#ccc';
+	c.strokeRect(pad, pad, w - 2 * pad, h - 2 * pad);
+	c.strokeStyle = '#36c';
+	c.beginPath();
+	history.forEach(function(p, i) {
+		const x = pad + (w - 2 * pad) * p.time / tmax;
+		const y = h - pad - (h - 2 * pad) * p[key] / vmax;
+		if (i === 0) c.moveTo(x, y); else c.lineTo(x, y);
+	});
+	c.stroke();
+}
+</script>
+</body>
+</html>
+`))
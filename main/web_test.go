@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The dashboard offers a control for every option that /events takes.
+func TestDashboardForm(t *testing.T) {
+	fs, _ := eventFlags(newConfig())
+	newConfig().registerFlags(fs)
+	w := httptest.NewRecorder()
+	serveDashboard(w, httptest.NewRequest("GET", "/", nil))
+	page := w.Body.String()
+	for _, name := range []string{"speed", "policy", "boarding", "cancel", "buttons", "classes", "groups", "capacity"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("/events has no option %s", name)
+		}
+		if !strings.Contains(page, `name="`+name+`"`) {
+			t.Errorf("the form has no control for %s", name)
+		}
+	}
+	for _, f := range formFields() {
+		if f.Name == "policy" && strings.Join(f.Choices, ",") != strings.Join(policyNames(), ",") {
+			t.Errorf("policy offers %v, want %v", f.Choices, policyNames())
+		}
+		if f.Name == "cancel" && (f.Kind != "select" || f.Default != "false") {
+			t.Errorf("cancel is a %s defaulting to %q", f.Kind, f.Default)
+		}
+	}
+}